@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/history"
+)
+
+// defaultChunkDays is how many days of transactions a backfill gets per request.
+const defaultChunkDays int = 30
+
+// dateChunk is a range of booking dates, including both ends.
+type dateChunk struct {
+	from time.Time
+	to   time.Time
+}
+
+// chunkDateRange splits the dates from from to to into chunks of at most
+// chunkDays days each.
+func chunkDateRange(from time.Time, to time.Time, chunkDays int) ([]dateChunk, error) {
+	if chunkDays < 1 {
+		return nil, errors.New("chunk size must be at least one day")
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("backfill end %s is before its start %s", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+	var chunks []dateChunk
+	for start := from; !start.After(to); start = start.AddDate(0, 0, chunkDays) {
+		end := start.AddDate(0, 0, chunkDays-1)
+		if end.After(to) {
+			end = to
+		}
+		chunks = append(chunks, dateChunk{from: start, to: end})
+	}
+	return chunks, nil
+}
+
+// runBackfill syncs each account for every chunk of the date range in turn.
+// Like runSync, it returns errSyncInProgress if another sync is running.
+func runBackfill(toSync []*syncAccount, chunks []dateChunk) (err error) {
+	if !syncState.begin() {
+		return errSyncInProgress
+	}
+	run := &history.Run{Kind: history.KindBackfill, Start: time.Now()}
+	forgetKnownPayees()
+	cachePostedTransactions()
+	defer func() {
+		forgetPostedTransactions()
+		syncState.end(err)
+		recordRun(run, err)
+	}()
+	var failed []string
+	for _, account := range toSync {
+		log.Printf("Backfilling account %s from %s to %s in %d chunks", account.Name, chunks[0].from.Format("2006-01-02"), chunks[len(chunks)-1].to.Format("2006-01-02"), len(chunks))
+		for _, chunk := range chunks {
+			log.Printf("Backfilling %s to %s", chunk.from.Format("2006-01-02"), chunk.to.Format("2006-01-02"))
+			result, err := syncAccountTransactions(account, chunk.from, chunk.to)
+			run.Accounts = append(run.Accounts, result)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s (%s to %s)", account.Name, chunk.from.Format("2006-01-02"), chunk.to.Format("2006-01-02")))
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed backfilling accounts: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func backfillCommand(args []string) int {
+	flags := newFlagSet("backfill")
+	accountName := flags.String("account", "", "backfill only the account with this name")
+	fromFlag := flags.String("from", "", "first booking date to get, as YYYY-MM-DD (required)")
+	toFlag := flags.String("to", time.Now().Format("2006-01-02"), "last booking date to get, as YYYY-MM-DD")
+	chunkDays := flags.Int("chunk-days", defaultChunkDays, "how many days to get per request")
+	dryRunFlag := flags.Bool("dry-run", false, "show the transactions without posting them to YNAB")
+	format := flags.String("format", "table", "dry run output format, table or json")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" {
+		log.Printf("Unknown format %s, use table or json", *format)
+		return exitUsage
+	}
+	from, err := time.Parse("2006-01-02", *fromFlag)
+	if err != nil {
+		log.Printf("Invalid -from date %q, use YYYY-MM-DD", *fromFlag)
+		return exitUsage
+	}
+	to, err := time.Parse("2006-01-02", *toFlag)
+	if err != nil {
+		log.Printf("Invalid -to date %q, use YYYY-MM-DD", *toFlag)
+		return exitUsage
+	}
+	chunks, err := chunkDateRange(from, to, *chunkDays)
+	if err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if exitCode := setupSync(); exitCode != exitOK {
+		return exitCode
+	}
+	if *dryRunFlag || dryRun {
+		return dryRunOnce(*accountName, chunks, *format)
+	}
+	return backfillOnce(*accountName, chunks)
+}
+
+// backfillOnce backfills all accounts, or only the named one, and returns the exit code.
+func backfillOnce(accountName string, chunks []dateChunk) int {
+	toSync, exitCode := accountsToSync(accountName)
+	if toSync == nil {
+		return exitCode
+	}
+	if err := runBackfill(toSync, chunks); err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+	return exitOK
+}
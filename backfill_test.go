@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestChunkDateRange(t *testing.T) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Run("Ranges are split into chunks", func(t *testing.T) {
+		chunks, err := chunkDateRange(from, time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC), 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []string{"2020-01-01 2020-01-30", "2020-01-31 2020-02-29", "2020-03-01 2020-03-15"}
+		if len(chunks) != len(expect) {
+			t.Fatalf("Got wrong number of chunks. Got %d want %d", len(chunks), len(expect))
+		}
+		for i, chunk := range chunks {
+			if got := chunk.from.Format("2006-01-02") + " " + chunk.to.Format("2006-01-02"); got != expect[i] {
+				t.Errorf("Got wrong chunk. Got %s want %s", got, expect[i])
+			}
+		}
+	})
+	t.Run("A single day is one chunk", func(t *testing.T) {
+		chunks, _ := chunkDateRange(from, from, 30)
+		if len(chunks) != 1 || !chunks[0].from.Equal(from) || !chunks[0].to.Equal(from) {
+			t.Errorf("Got wrong chunks for a single day: %v", chunks)
+		}
+	})
+	t.Run("Invalid ranges are refused", func(t *testing.T) {
+		if _, err := chunkDateRange(from, from.AddDate(0, 0, -1), 30); err == nil {
+			t.Error("Range ending before it starts did not return an error")
+		}
+		if _, err := chunkDateRange(from, from, 0); err == nil {
+			t.Error("Empty chunk size did not return an error")
+		}
+	})
+}
+
+func TestBackfillOnce(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	testConnectorAuthorizeResponse = ""
+	setDummyYnabData()
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	chunks, _ := chunkDateRange(from, from.AddDate(0, 0, 44), 30)
+	testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+	testLogBuffer.ExpectLog("Backfilling account default from 2020-01-01 to 2020-02-14 in 2 chunks")
+	testLogBuffer.ExpectLog("Backfilling 2020-01-01 to 2020-01-30")
+	testLogBuffer.ExpectLog("Syncing account default")
+	testLogBuffer.ExpectLog("Received 0 transactions from bank")
+	testLogBuffer.ExpectLog("Ending run")
+	testLogBuffer.ExpectLog("Backfilling 2020-01-31 to 2020-02-14")
+	testLogBuffer.ExpectLog("Syncing account default")
+	testLogBuffer.ExpectLog("Received 0 transactions from bank")
+	testLogBuffer.ExpectLog("Ending run")
+	assertExitCode(t, exitOK, backfillOnce("", chunks))
+	testLogBuffer.TestLogValues(t)
+	if len(testConnectorGetTransactionsWindows) != 2 || !testConnectorGetTransactionsWindows[1][0].Equal(chunks[1].from) {
+		t.Errorf("Connector got wrong date windows: %v", testConnectorGetTransactionsWindows)
+	}
+}
+
+func TestBackfillDryRun(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	defer func() { output = os.Stdout }()
+	defer gock.Off()
+	testConnectorAuthorizeResponse = ""
+	setDummyTransactionResponse()
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	chunks, _ := chunkDateRange(from, from.AddDate(0, 0, 44), 30)
+	got := &bytes.Buffer{}
+	output = got
+	testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+	testLogBuffer.ExpectLog("Dry run for account default")
+	testLogBuffer.ExpectLog("Dry run for 2020-01-01 to 2020-01-30")
+	testLogBuffer.ExpectLog("Received 1 transactions from bank, not posting them to YNAB")
+	testLogBuffer.ExpectLog("Dry run for 2020-01-31 to 2020-02-14")
+	testLogBuffer.ExpectLog("Received 1 transactions from bank, not posting them to YNAB")
+	assertExitCode(t, exitOK, dryRunOnce("", chunks, "json"))
+	testLogBuffer.TestLogValues(t)
+	if len(testConnectorGetTransactionsWindows) != 2 || !testConnectorGetTransactionsWindows[1][0].Equal(chunks[1].from) {
+		t.Errorf("Connector got wrong date windows: %v", testConnectorGetTransactionsWindows)
+	}
+	if strings.Count(got.String(), `"import_id": "import-id"`) != 2 {
+		t.Errorf("Dry run output is missing the transactions of a chunk: %s", got.String())
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("Dry run of a backfill posted to YNAB")
+	}
+}
+
+func TestSyncWindow(t *testing.T) {
+	now := time.Date(2020, 5, 15, 12, 0, 0, 0, time.UTC)
+	account := &syncAccount{}
+	from, to := account.syncWindow(now)
+	if !from.Equal(now.AddDate(0, 0, -10)) || !to.Equal(now) {
+		t.Errorf("Got wrong default sync window. Got %s to %s", from, to)
+	}
+	account.LookbackDays = 60
+	if from, _ := account.syncWindow(now); !from.Equal(now.AddDate(0, 0, -60)) {
+		t.Errorf("Got wrong sync window with a lookback. Got %s want %s", from, now.AddDate(0, 0, -60))
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"go.bmvs.io/ynab"
+	"go.bmvs.io/ynab/api"
+	"go.bmvs.io/ynab/api/transaction"
+)
+
+// BalanceConnector is implemented by connectors which can get the current
+// balance of an account, in milliunits.
+type BalanceConnector interface {
+	GetBalance(account config.Account) (int64, error)
+}
+
+// balanceAdjustmentPayee is the payee YNAB uses for its own reconciliation
+// adjustments.
+const balanceAdjustmentPayee string = "Reconciliation Balance Adjustment"
+
+var balanceCheckSettings config.BalanceCheck
+
+// balanceDrift is a difference between the balance of an account at the bank
+// and its cleared balance in YNAB, in milliunits.
+type balanceDrift struct {
+	Account     string `json:"account"`
+	BankBalance int64  `json:"bank_balance"`
+	YNABBalance int64  `json:"ynab_balance"`
+	Drift       int64  `json:"drift"`
+	Adjusted    bool   `json:"adjusted"`
+}
+
+// checkBalance compares the balance of an account at the bank with its cleared
+// balance in YNAB, reports any difference in the sync status and returns it.
+// With adjustments enabled, it posts the difference as a cleared transaction,
+// like a reconciliation in YNAB does, but only once the previous check found
+// the same difference, see repeatedDrift. A difference which goes away by
+// itself, like a transfer leg which is left out until the next sync, is never
+// adjusted.
+func checkBalance(account *syncAccount) (drift balanceDrift) {
+	if !balanceCheckSettings.Enabled {
+		return drift
+	}
+	connector, ok := account.connector.(BalanceConnector)
+	if !ok {
+		return drift
+	}
+	bankBalance, err := connector.GetBalance(account.Account)
+	if err != nil {
+		log.Printf("Failed getting the bank balance of account %s: %s", account.Name, err)
+		return drift
+	}
+	ynabAccount, err := ynab.NewClient(ynabSecret).Account().GetAccount(account.YNABBudgetID, account.YNABAccountID)
+	if err != nil {
+		log.Printf("Failed getting YNAB account %s: %s", account.YNABAccountID, err)
+		return drift
+	}
+	drift = balanceDrift{
+		Account:     account.Name,
+		BankBalance: bankBalance,
+		YNABBalance: ynabAccount.ClearedBalance,
+		Drift:       bankBalance - ynabAccount.ClearedBalance,
+	}
+	repeated := repeatedDrift(account.Name, drift.Drift)
+	if drift.Drift == 0 {
+		return drift
+	}
+	log.Printf("Balance of account %s is %s at the bank and %s cleared in YNAB, a difference of %s", account.Name, formatMilliunits(drift.BankBalance), formatMilliunits(drift.YNABBalance), formatMilliunits(drift.Drift))
+	if balanceCheckSettings.Adjust {
+		if repeated {
+			drift.Adjusted = postBalanceAdjustment(account, drift.Drift)
+		} else {
+			log.Printf("Not adjusting the balance of account %s until the next sync finds the same difference", account.Name)
+		}
+	}
+	if drift.Adjusted {
+		repeatedDrift(account.Name, 0)
+	}
+	syncState.reportDrift(drift)
+	return drift
+}
+
+// postBalanceAdjustment posts a cleared, approved transaction for the
+// difference in balance. It returns whether it succeeded.
+func postBalanceAdjustment(account *syncAccount, amount int64) bool {
+	today, _ := api.DateFromString(time.Now().Format(api.DateFormat))
+	payee, memo := balanceAdjustmentPayee, "Adjusted to the bank balance"
+	adjustment := ynabTransaction{
+		AccountID: account.YNABAccountID,
+		Date:      today,
+		Amount:    amount,
+		Cleared:   transaction.ClearingStatusCleared,
+		Approved:  true,
+		PayeeName: &payee,
+		Memo:      &memo,
+	}
+	if _, err := ynab.NewClient(ynabSecret).Transaction().CreateTransaction(account.YNABBudgetID, adjustment); err != nil {
+		log.Printf("Failed posting balance adjustment for account %s: %s", account.Name, err)
+		return false
+	}
+	log.Printf("Posted balance adjustment of %s for account %s", formatMilliunits(amount), account.Name)
+	return true
+}
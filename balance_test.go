@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// balanceTestConnector is a test connector which also reports a balance.
+type balanceTestConnector struct {
+	testConnector
+	balance int64
+}
+
+func (c balanceTestConnector) GetBalance(account config.Account) (int64, error) {
+	return c.balance, nil
+}
+
+func TestCheckBalance(t *testing.T) {
+	setDummyConnector(true)
+	setDummyYnabData()
+	defer func() { balanceCheckSettings = config.BalanceCheck{} }()
+	defer func() { syncState.lastDrifts = nil }()
+	accounts[0].connector = balanceTestConnector{balance: 1250000}
+	mockYNABAccount := func(clearedBalance string) {
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/" + dummyYnabAccountID).
+			Reply(200).
+			BodyString(`{"data":{"account":{"id":"` + dummyYnabAccountID + `","balance":1190000,"cleared_balance":` + clearedBalance + `}}}`)
+	}
+	sync := func() []balanceDrift {
+		syncState.begin()
+		checkBalance(accounts[0])
+		syncState.end(nil)
+		return syncState.status(nil).BalanceDrift
+	}
+	t.Run("Drift is reported in the sync status", func(t *testing.T) {
+		defer gock.Off()
+		syncState.lastDrifts = nil
+		mockYNABAccount("1200000")
+		balanceCheckSettings = config.BalanceCheck{Enabled: true}
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Balance of account default is 1250.00 at the bank and 1200.00 cleared in YNAB, a difference of 50.00")
+		syncState.begin()
+		if drift := checkBalance(accounts[0]); drift.Drift != 50000 {
+			t.Errorf("Got wrong drift for the run result. Got %d want 50000", drift.Drift)
+		}
+		syncState.end(nil)
+		drifts := syncState.status(nil).BalanceDrift
+		testLogBuffer.TestLogValues(t)
+		if len(drifts) != 1 || drifts[0].Drift != 50000 || drifts[0].Adjusted {
+			t.Errorf("Got wrong balance drift. Got %+v", drifts)
+		}
+	})
+	t.Run("Adjustments are posted when the next sync finds the same drift", func(t *testing.T) {
+		defer gock.Off()
+		syncState.lastDrifts = nil
+		balanceCheckSettings = config.BalanceCheck{Enabled: true, Adjust: true}
+		mockYNABAccount("1200000")
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Balance of account default is 1250.00 at the bank and 1200.00 cleared in YNAB, a difference of 50.00")
+		testLogBuffer.ExpectLog("Not adjusting the balance of account default until the next sync finds the same difference")
+		if drifts := sync(); len(drifts) != 1 || drifts[0].Adjusted {
+			t.Errorf("Drift was adjusted in the first sync which found it. Got %+v", drifts)
+		}
+		testLogBuffer.TestLogValues(t)
+		mockYNABAccount("1200000")
+		gock.New("https://api.youneedabudget.com/").
+			Post("/v1/budgets/" + dummyYnabBudgetID + "/transactions").
+			MatchType("json").
+			BodyString(`"amount":50000,"cleared":"cleared","approved":true,"payee_id":null,"payee_name":"Reconciliation Balance Adjustment"`).
+			Reply(201).
+			BodyString(`{"data":{"transaction_ids":["adjustment-id"]}}`)
+		drifts := sync()
+		if !gock.IsDone() {
+			t.Error("Balance adjustment was not posted")
+		}
+		if len(drifts) != 1 || !drifts[0].Adjusted {
+			t.Errorf("Got wrong balance drift. Got %+v", drifts)
+		}
+	})
+	t.Run("Drift which goes away is not adjusted", func(t *testing.T) {
+		defer gock.Off()
+		syncState.lastDrifts = nil
+		balanceCheckSettings = config.BalanceCheck{Enabled: true, Adjust: true}
+		for _, clearedBalance := range []string{"1200000", "1250000", "1200000"} {
+			mockYNABAccount(clearedBalance)
+			for _, drift := range sync() {
+				if drift.Adjusted {
+					t.Errorf("Drift was adjusted after it went away. Got %+v", drift)
+				}
+			}
+		}
+		if gock.HasUnmatchedRequest() {
+			t.Error("Balance adjustment was posted after the drift went away")
+		}
+	})
+	t.Run("With a history, drift found by an earlier process is adjusted", func(t *testing.T) {
+		defer gock.Off()
+		dir, err := ioutil.TempDir("", "history")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		historySettings = config.History{File: filepath.Join(dir, "history.db")}
+		defer func() { historySettings = config.History{} }()
+		balanceCheckSettings = config.BalanceCheck{Enabled: true, Adjust: true}
+		tools.CreateAndActivateEmptyTestLogBuffer()
+		mockYNABAccount("1200000")
+		sync()
+		syncState.lastDrifts = nil
+		mockYNABAccount("1200000")
+		gock.New("https://api.youneedabudget.com/").
+			Post("/v1/budgets/" + dummyYnabBudgetID + "/transactions").
+			Reply(201).
+			BodyString(`{"data":{"transaction_ids":["adjustment-id"]}}`)
+		if drifts := sync(); len(drifts) != 1 || !drifts[0].Adjusted {
+			t.Errorf("Drift kept in the history was not adjusted. Got %+v", drifts)
+		}
+		if !gock.IsDone() {
+			t.Error("Balance adjustment was not posted")
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package bank
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+)
+
+// The longest payee name and memo YNAB accepts.
+const (
+	MaxPayeeLength int = 50
+	MaxMemoLength  int = 200
+)
+
+// DefaultForeignCurrencyMemo is appended to the memo of transactions made in a
+// foreign currency, unless the account sets another template.
+const DefaultForeignCurrencyMemo string = "({{.ForeignAmount}} {{.ForeignCurrency}} at {{.FxRate}})"
+
+// TemplateData is what payee and memo templates are executed with: all bank
+// details, plus the payee and memo the connector chose.
+type TemplateData struct {
+	Details
+	Payee string
+	Memo  string
+}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"title": strings.Title,
+	"trim":  strings.TrimSpace,
+	"replace": func(old string, new string, text string) string {
+		return strings.Replace(text, old, new, -1)
+	},
+	"default": func(fallback string, text string) string {
+		if strings.TrimSpace(text) == "" {
+			return fallback
+		}
+		return text
+	},
+}
+
+// ParseTemplate parses a payee or memo template, or returns nil if there is
+// none. The template is tried on an empty transaction, so unknown fields are
+// found before the first sync.
+func ParseTemplate(name string, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(ioutil.Discard, TemplateData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Format sets the payee name and memo from templates, normalizes their
+// whitespace and cuts them to YNAB's limits. Without a template, the
+// connector's value is kept.
+func (t *Transaction) Format(payeeTemplate *template.Template, memoTemplate *template.Template) error {
+	data := TemplateData{Details: t.Details, Payee: stringValue(t.PayeeName), Memo: stringValue(t.Memo)}
+	payee, err := execute(payeeTemplate, data, data.Payee)
+	if err != nil {
+		return err
+	}
+	memo, err := execute(memoTemplate, data, data.Memo)
+	if err != nil {
+		return err
+	}
+	t.PayeeName = stringPointer(tools.NormalizeText(payee, MaxPayeeLength))
+	t.Memo = stringPointer(tools.NormalizeText(memo, MaxMemoLength))
+	return nil
+}
+
+// AppendMemo appends the result of a template to the memo, separated by a space
+// and cut to YNAB's limit.
+func (t *Transaction) AppendMemo(tmpl *template.Template) error {
+	data := TemplateData{Details: t.Details, Payee: stringValue(t.PayeeName), Memo: stringValue(t.Memo)}
+	addition, err := execute(tmpl, data, "")
+	if err != nil {
+		return err
+	}
+	t.Memo = stringPointer(tools.NormalizeText(data.Memo+" "+addition, MaxMemoLength))
+	return nil
+}
+
+func execute(tmpl *template.Template, data TemplateData, fallback string) (string, error) {
+	if tmpl == nil {
+		return fallback, nil
+	}
+	var result bytes.Buffer
+	if err := tmpl.Execute(&result, data); err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// stringPointer returns nil for empty strings, so YNAB gets no value.
+func stringPointer(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,86 @@
+package bank
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	payee, memo := "Rossmann", "POS MIT PIN.  Mein Drogeriemarkt,\n Leipziger Str."
+	newTransaction := func() Transaction {
+		transaction := Transaction{Details: Details{CounterPartyName: payee, CreditorID: "DE0222200004544221", ValueDate: "2019-11-03"}}
+		transaction.PayeeName = &payee
+		transaction.Memo = &memo
+		return transaction
+	}
+	t.Run("Without templates the connector's values are normalized", func(t *testing.T) {
+		transaction := newTransaction()
+		if err := transaction.Format(nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		assertText(t, transaction.PayeeName, "Rossmann")
+		assertText(t, transaction.Memo, "POS MIT PIN. Mein Drogeriemarkt, Leipziger Str.")
+	})
+	t.Run("Templates have access to bank fields", func(t *testing.T) {
+		payeeTemplate, _ := ParseTemplate("payee", "{{.CounterPartyName | upper}}")
+		memoTemplate, _ := ParseTemplate("memo", "{{.Memo}} (valued {{.ValueDate}}, creditor {{.CreditorID}})")
+		transaction := newTransaction()
+		if err := transaction.Format(payeeTemplate, memoTemplate); err != nil {
+			t.Fatal(err)
+		}
+		assertText(t, transaction.PayeeName, "ROSSMANN")
+		assertText(t, transaction.Memo, "POS MIT PIN. Mein Drogeriemarkt, Leipziger Str. (valued 2019-11-03, creditor DE0222200004544221)")
+	})
+	t.Run("Results are cut to YNAB's limits", func(t *testing.T) {
+		payeeTemplate, _ := ParseTemplate("payee", strings.Repeat("{{.Payee}} ", 10))
+		transaction := newTransaction()
+		transaction.Format(payeeTemplate, nil)
+		if length := len(*transaction.PayeeName); length != MaxPayeeLength {
+			t.Errorf("Got wrong payee length. Got %d want %d", length, MaxPayeeLength)
+		}
+	})
+	t.Run("Empty results are left out", func(t *testing.T) {
+		memoTemplate, _ := ParseTemplate("memo", "{{.MandateReference}}")
+		transaction := newTransaction()
+		transaction.Format(nil, memoTemplate)
+		if transaction.Memo != nil {
+			t.Errorf("Got a memo for an empty template result: %q", *transaction.Memo)
+		}
+	})
+}
+
+func TestAppendMemo(t *testing.T) {
+	tmpl, _ := ParseTemplate("foreign_currency_memo", DefaultForeignCurrencyMemo)
+	memo := "Hotel"
+	transaction := Transaction{Details: Details{ForeignAmount: "-120.00", ForeignCurrency: "USD", FxRate: "1.0873"}}
+	transaction.Memo = &memo
+	if err := transaction.AppendMemo(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	assertText(t, transaction.Memo, "Hotel (-120.00 USD at 1.0873)")
+	transaction.Memo = nil
+	transaction.AppendMemo(tmpl)
+	assertText(t, transaction.Memo, "(-120.00 USD at 1.0873)")
+}
+
+func TestParseTemplate(t *testing.T) {
+	if tmpl, err := ParseTemplate("payee", ""); tmpl != nil || err != nil {
+		t.Errorf("Empty template was not skipped. Got %v, %v", tmpl, err)
+	}
+	if _, err := ParseTemplate("payee", "{{.Reference}}"); err == nil {
+		t.Error("Template with an unknown field did not return an error")
+	}
+	if _, err := ParseTemplate("payee", "{{.Payee"); err == nil {
+		t.Error("Invalid template did not return an error")
+	}
+}
+
+func assertText(t *testing.T, got *string, expect string) {
+	if got == nil {
+		t.Errorf("Got no value, want %q", expect)
+		return
+	}
+	if *got != expect {
+		t.Errorf("Got wrong value. Got %q want %q", *got, expect)
+	}
+}
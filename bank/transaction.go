@@ -0,0 +1,89 @@
+// Package bank holds the transaction type connectors return: a transaction in
+// YNAB format, along with the details the bank provided for it.
+package bank
+
+import (
+	"go.bmvs.io/ynab/api/transaction"
+)
+
+// Transaction is a bank transaction converted to YNAB format. Details keeps the
+// bank's own fields, for rules and templates which need more than YNAB has.
+type Transaction struct {
+	transaction.PayloadTransaction
+	Details Details `json:"bank"`
+	// LegacyImportID is the import ID earlier versions gave the transaction,
+	// if it has changed since. Transactions imported with it keep it.
+	LegacyImportID string `json:"-"`
+}
+
+// Details are the fields a bank provides for a transaction. Connectors fill in
+// the ones their bank has, the others are empty.
+type Details struct {
+	ID                    string `json:"id,omitempty"`
+	BookingDate           string `json:"booking_date,omitempty"`
+	ValueDate             string `json:"value_date,omitempty"`
+	Amount                string `json:"amount,omitempty"`
+	CurrencyCode          string `json:"currency_code,omitempty"`
+	CounterPartyName      string `json:"counter_party_name,omitempty"`
+	CounterPartyIBAN      string `json:"counter_party_iban,omitempty"`
+	PaymentReference      string `json:"payment_reference,omitempty"`
+	PaymentIdentification string `json:"payment_identification,omitempty"`
+	// SEPA direct debits have a mandate reference and the creditor's ID.
+	MandateReference string `json:"mandate_reference,omitempty"`
+	CreditorID       string `json:"creditor_id,omitempty"`
+	E2EReference     string `json:"e2e_reference,omitempty"`
+	TransactionCode  string `json:"transaction_code,omitempty"`
+	// ISO 20022 bank transaction codes, e.g. PMNT, RDDT and ESDD for a SEPA direct debit.
+	DomainCode    string `json:"domain_code,omitempty"`
+	FamilyCode    string `json:"family_code,omitempty"`
+	SubFamilyCode string `json:"sub_family_code,omitempty"`
+	// Card transactions are billed later, and may be in a foreign currency.
+	BillingDate     string `json:"billing_date,omitempty"`
+	ForeignAmount   string `json:"foreign_amount,omitempty"`
+	ForeignCurrency string `json:"foreign_currency,omitempty"`
+	FxRate          string `json:"fx_rate,omitempty"`
+	// Pending transactions are authorized, but not booked yet.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// PendingImportIDPrefix starts the import IDs of pending transactions.
+const PendingImportIDPrefix string = "PENDING:"
+
+// Kinds of transactions.
+const (
+	KindCard        string = "card"
+	KindDirectDebit string = "direct_debit"
+	KindTransfer    string = "transfer"
+)
+
+// Kind returns what kind of transaction this is, from its bank transaction
+// codes, or an empty string if it is not known.
+func (d Details) Kind() string {
+	switch d.FamilyCode {
+	case "CCRD", "MCRD", "POSD":
+		return KindCard
+	case "RDDT", "IDDT":
+		return KindDirectDebit
+	case "RCDT", "ICDT":
+		return KindTransfer
+	}
+	if d.CreditorID != "" || d.MandateReference != "" {
+		return KindDirectDebit
+	}
+	return ""
+}
+
+// IsForeignCurrency checks if the transaction was made in a currency other than
+// the one it was booked in.
+func (d Details) IsForeignCurrency() bool {
+	return d.ForeignCurrency != "" && d.CurrencyCode != "" && d.ForeignCurrency != d.CurrencyCode
+}
+
+// Payloads returns the YNAB format of each transaction.
+func Payloads(transactions []Transaction) []transaction.PayloadTransaction {
+	payloads := make([]transaction.PayloadTransaction, 0, len(transactions))
+	for _, t := range transactions {
+		payloads = append(payloads, t.PayloadTransaction)
+	}
+	return payloads
+}
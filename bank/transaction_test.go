@@ -0,0 +1,34 @@
+package bank
+
+import (
+	"testing"
+)
+
+func TestKind(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		details Details
+		expect  string
+	}{
+		{"Card payments", Details{DomainCode: "PMNT", FamilyCode: "CCRD", SubFamilyCode: "POSD"}, KindCard},
+		{"Direct debits", Details{DomainCode: "PMNT", FamilyCode: "RDDT", SubFamilyCode: "ESDD"}, KindDirectDebit},
+		{"Direct debits without codes", Details{CreditorID: "DE0222200004544221"}, KindDirectDebit},
+		{"Transfers", Details{DomainCode: "PMNT", FamilyCode: "RCDT", SubFamilyCode: "ESCT"}, KindTransfer},
+		{"Unknown codes", Details{FamilyCode: "XXXX"}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.details.Kind(); got != test.expect {
+				t.Errorf("Got wrong kind. Got %q want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestIsForeignCurrency(t *testing.T) {
+	if !(Details{CurrencyCode: "EUR", ForeignCurrency: "USD"}).IsForeignCurrency() {
+		t.Error("Transaction in USD booked in EUR is not in a foreign currency")
+	}
+	if (Details{CurrencyCode: "EUR", ForeignCurrency: "EUR"}).IsForeignCurrency() || (Details{CurrencyCode: "EUR"}).IsForeignCurrency() {
+		t.Error("Transaction in EUR is in a foreign currency")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/rules"
+	"go.bmvs.io/ynab"
+)
+
+var (
+	// categoryRules set the category of transactions, if a rules file is set.
+	categoryRules *rules.CategoryRules
+	// categoryIDs maps each budget's category names from the rules to their IDs.
+	categoryIDs map[string]map[string]string
+)
+
+func resolveCategoriesOrFatal() {
+	if err := resolveCategories(); err != nil {
+		fatalError(err)
+	}
+}
+
+// resolveCategories looks up the categories named in the category rules in the
+// budget of each account.
+func resolveCategories() error {
+	categoryIDs = make(map[string]map[string]string)
+	if categoryRules == nil || len(categoryRules.Rules()) == 0 {
+		return nil
+	}
+	for _, account := range accounts {
+		if _, resolved := categoryIDs[account.YNABBudgetID]; resolved {
+			continue
+		}
+		ids, err := resolveBudgetCategories(account.YNABBudgetID)
+		if err != nil {
+			return err
+		}
+		categoryIDs[account.YNABBudgetID] = ids
+		log.Printf("Found the categories of %d category rules in YNAB budget %s", len(categoryRules.Rules()), account.YNABBudgetID)
+	}
+	return nil
+}
+
+// resolveBudgetCategories maps the category names of the rules to their IDs in
+// a budget. Names are either "Group: Category" or only the category, which must
+// then be unique in the budget.
+func resolveBudgetCategories(budgetID string) (map[string]string, error) {
+	snapshot, err := ynab.NewClient(ynabSecret).Category().GetCategories(budgetID, nil)
+	if err != nil {
+		return nil, &categoriesUnavailableError{budgetID, err}
+	}
+	byName := make(map[string][]string)
+	for _, group := range snapshot.GroupWithCategories {
+		if group.Deleted {
+			continue
+		}
+		for _, category := range group.Categories {
+			if category.Deleted {
+				continue
+			}
+			name := strings.ToLower(strings.TrimSpace(category.Name))
+			byName[strings.ToLower(strings.TrimSpace(group.Name))+": "+name] = []string{category.ID}
+			byName[name] = append(byName[name], category.ID)
+		}
+	}
+	ids := make(map[string]string)
+	for i, rule := range categoryRules.Rules() {
+		matches := byName[normalizeCategoryName(rule.Category)]
+		switch {
+		case len(matches) == 0:
+			return nil, fmt.Errorf("%s: categories[%d].category: unknown category %q in YNAB budget %s", rule.Source, i, rule.Category, budgetID)
+		case len(matches) > 1:
+			return nil, fmt.Errorf("%s: categories[%d].category: category %q is in more than one group of YNAB budget %s, use \"Group: Category\"", rule.Source, i, rule.Category, budgetID)
+		}
+		ids[rule.Category] = matches[0]
+	}
+	return ids, nil
+}
+
+// categoriesUnavailableError means the categories of a budget could not be got
+// from YNAB, unlike an error in the category rules.
+type categoriesUnavailableError struct {
+	budgetID string
+	err      error
+}
+
+func (e *categoriesUnavailableError) Error() string {
+	return fmt.Sprintf("failed getting the categories of YNAB budget %s: %s", e.budgetID, e.err)
+}
+
+func (e *categoriesUnavailableError) Unwrap() error {
+	return e.err
+}
+
+// normalizeCategoryName ignores case and the spaces around the group separator.
+func normalizeCategoryName(name string) string {
+	parts := strings.SplitN(name, ":", 2)
+	for i := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(parts[i]))
+	}
+	return strings.Join(parts, ": ")
+}
+
+// categorize sets the category of transactions which match a category rule,
+// unless the connector already set one.
+func categorize(account *syncAccount, transactions []bank.Transaction, knownPayees rules.KnownPayees) {
+	if categoryRules == nil {
+		return
+	}
+	for i, transaction := range transactions {
+		if transaction.CategoryID != nil {
+			continue
+		}
+		rule := categoryRules.Match(transaction, knownPayees)
+		if rule == nil {
+			continue
+		}
+		if id, ok := categoryIDs[account.YNABBudgetID][rule.Category]; ok {
+			transactions[i].CategoryID = &id
+		}
+	}
+}
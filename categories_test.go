@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/rules"
+	"gopkg.in/h2non/gock.v1"
+)
+
+const categoriesResponse string = `{"data":{"category_groups":[{"id":"everyday-id","name":"Everyday Expenses","hidden":false,"deleted":false,"categories":[{"id":"groceries-id","category_group_id":"everyday-id","name":"Groceries","hidden":false,"deleted":false},{"id":"fees-id","category_group_id":"everyday-id","name":"Fees","hidden":false,"deleted":false}]},{"id":"monthly-id","name":"Monthly Bills","hidden":false,"deleted":false,"categories":[{"id":"rent-id","category_group_id":"monthly-id","name":"Rent","hidden":false,"deleted":false},{"id":"bank-fees-id","category_group_id":"monthly-id","name":"Fees","hidden":false,"deleted":false},{"id":"old-id","category_group_id":"monthly-id","name":"Phone","hidden":false,"deleted":true}]}],"server_knowledge":1}}`
+
+func TestResolveCategories(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	setDummyYnabData()
+	defer func() { categoryRules, categoryIDs = nil, nil }()
+	mockCategories := func() {
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/"+dummyYnabBudgetID+"/categories").
+			MatchHeader("Authorization", "Bearer "+dummyYnabSecret).
+			Reply(200).
+			BodyString(categoriesResponse)
+	}
+	t.Run("Category names are resolved with or without their group", func(t *testing.T) {
+		defer gock.Off()
+		mockCategories()
+		categoryRules, _ = rules.NewCategoryRules([]config.CategoryRule{
+			{Category: "groceries", Conditions: config.Conditions{Payee: "rewe"}},
+			{Category: "Monthly Bills : Fees", Conditions: config.Conditions{Kind: bank.KindDirectDebit}},
+		})
+		if err := resolveCategories(); err != nil {
+			t.Fatal(err)
+		}
+		expect := map[string]string{"groceries": "groceries-id", "Monthly Bills : Fees": "bank-fees-id"}
+		for name, id := range expect {
+			if got := categoryIDs[dummyYnabBudgetID][name]; got != id {
+				t.Errorf("Got wrong category ID for %s. Got %s want %s", name, got, id)
+			}
+		}
+	})
+	t.Run("Unknown categories are refused", func(t *testing.T) {
+		for _, test := range []struct {
+			category string
+			expect   string
+		}{
+			{"Phone", `rules.yaml:3: categories[0].category: unknown category "Phone" in YNAB budget ` + dummyYnabBudgetID},
+			{"Fees", `rules.yaml:3: categories[0].category: category "Fees" is in more than one group of YNAB budget ` + dummyYnabBudgetID + `, use "Group: Category"`},
+		} {
+			mockCategories()
+			categoryRules, _ = rules.NewCategoryRules([]config.CategoryRule{{Category: test.category, Conditions: config.Conditions{Payee: "x"}, Source: "rules.yaml:3"}})
+			err := resolveCategories()
+			if err == nil || err.Error() != test.expect {
+				t.Errorf("Got wrong error. Got %v want %s", err, test.expect)
+			}
+		}
+		gock.Off()
+	})
+}
+
+func TestGetTransactionsCategories(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	setDummyYnabData()
+	defer func() { categoryRules, categoryIDs = nil, nil }()
+	categoryRules, _ = rules.NewCategoryRules([]config.CategoryRule{{Category: "Groceries", Conditions: config.Conditions{Payee: "^rewe"}}})
+	categoryIDs = map[string]map[string]string{dummyYnabBudgetID: {"Groceries": "groceries-id"}}
+	rewe, rossmann, rent := "REWE", "Rossmann", "rent-id"
+	testConnectorGetTransactionsResponse = []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{PayeeName: &rewe}},
+		{PayloadTransaction: ynabTransaction{PayeeName: &rossmann}},
+		{PayloadTransaction: ynabTransaction{PayeeName: &rewe, CategoryID: &rent}},
+	}
+	transactions, _ := getTransactions(accounts[0], time.Now(), time.Now())
+	if transactions[0].CategoryID == nil || *transactions[0].CategoryID != "groceries-id" {
+		t.Errorf("Matching transaction got wrong category: %v", transactions[0].CategoryID)
+	}
+	if transactions[1].CategoryID != nil {
+		t.Errorf("Transaction without a matching rule got category %s", *transactions[1].CategoryID)
+	}
+	if *transactions[2].CategoryID != "rent-id" {
+		t.Errorf("Category set by the connector was replaced with %s", *transactions[2].CategoryID)
+	}
+}
@@ -0,0 +1,115 @@
+// Package categorizer suggests YNAB categories for transactions with a naive
+// Bayes classifier, trained on transactions which are already categorized.
+package categorizer
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Example is a categorized transaction to learn from.
+type Example struct {
+	Text     string
+	Category string
+}
+
+// Model is a trained classifier. It needs no network access to make
+// suggestions.
+type Model struct {
+	// categories are sorted, so ties are broken the same way every time.
+	categories []string
+	// examples counts the examples of each category.
+	examples map[string]int
+	// tokens counts the tokens of each category.
+	tokens map[string]map[string]int
+	// tokenTotals is the number of tokens of each category.
+	tokenTotals map[string]int
+	vocabulary  map[string]bool
+	total       int
+}
+
+// Train returns a model trained on examples.
+func Train(examples []Example) *Model {
+	model := &Model{
+		examples:    make(map[string]int),
+		tokens:      make(map[string]map[string]int),
+		tokenTotals: make(map[string]int),
+		vocabulary:  make(map[string]bool),
+	}
+	for _, example := range examples {
+		tokens := Tokenize(example.Text)
+		if len(tokens) == 0 || example.Category == "" {
+			continue
+		}
+		if _, seen := model.examples[example.Category]; !seen {
+			model.categories = append(model.categories, example.Category)
+			model.tokens[example.Category] = make(map[string]int)
+		}
+		model.examples[example.Category]++
+		model.total++
+		for _, token := range tokens {
+			model.tokens[example.Category][token]++
+			model.tokenTotals[example.Category]++
+			model.vocabulary[token] = true
+		}
+	}
+	sort.Strings(model.categories)
+	return model
+}
+
+// Size returns the number of examples the model learned from.
+func (m *Model) Size() int {
+	return m.total
+}
+
+// Predict returns the most likely category for text, and its probability from
+// 0 to 1. Without any known tokens, it returns an empty category.
+func (m *Model) Predict(text string) (string, float64) {
+	var tokens []string
+	for _, token := range Tokenize(text) {
+		if m.vocabulary[token] {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 || len(m.categories) == 0 {
+		return "", 0
+	}
+	// Log probabilities with Laplace smoothing, so unseen tokens do not rule
+	// out a category.
+	scores := make([]float64, len(m.categories))
+	vocabularySize := float64(len(m.vocabulary))
+	best := 0
+	for i, category := range m.categories {
+		score := math.Log(float64(m.examples[category]) / float64(m.total))
+		for _, token := range tokens {
+			score += math.Log((float64(m.tokens[category][token]) + 1) / (float64(m.tokenTotals[category]) + vocabularySize))
+		}
+		scores[i] = score
+		if score > scores[best] {
+			best = i
+		}
+	}
+	sum := 0.0
+	for _, score := range scores {
+		sum += math.Exp(score - scores[best])
+	}
+	return m.categories[best], 1 / sum
+}
+
+// Tokenize splits text into lower case words, leaving out numbers and single
+// characters, which are mostly store numbers and dates.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		if len([]rune(word)) < 2 || strings.IndexFunc(word, unicode.IsLetter) < 0 {
+			continue
+		}
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
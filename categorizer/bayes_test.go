@@ -0,0 +1,52 @@
+package categorizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("REWE SAGT DANKE 4431//Berlin/DE, 12.05. K1")
+	expect := []string{"rewe", "sagt", "danke", "berlin", "de", "k1"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Got wrong tokens. Got %v want %v", got, expect)
+	}
+}
+
+func TestPredict(t *testing.T) {
+	model := Train([]Example{
+		{"REWE SAGT DANKE 4431//Berlin/DE", "groceries"},
+		{"REWE Markt GmbH", "groceries"},
+		{"EDEKA Center Berlin", "groceries"},
+		{"Shell Tankstelle Berlin", "fuel"},
+		{"ARAL Tankstelle", "fuel"},
+		{"Miete Wohnung Oktober", "rent"},
+		{"", "rent"},
+		{"Miete", ""},
+	})
+	if model.Size() != 6 {
+		t.Errorf("Model learned from the wrong number of examples. Got %d want 6", model.Size())
+	}
+	t.Run("Known merchants are predicted with confidence", func(t *testing.T) {
+		category, confidence := model.Predict("REWE SAGT DANKE 1234//Hamburg/DE")
+		if category != "groceries" || confidence < 0.8 {
+			t.Errorf("Got wrong prediction. Got %s with %f", category, confidence)
+		}
+	})
+	t.Run("Ambiguous text has a low confidence", func(t *testing.T) {
+		category, confidence := model.Predict("Berlin")
+		if confidence > 0.8 {
+			t.Errorf("Got a confident prediction for ambiguous text: %s with %f", category, confidence)
+		}
+	})
+	t.Run("Unknown text is not predicted", func(t *testing.T) {
+		if category, confidence := model.Predict("Rossmann 123"); category != "" || confidence != 0 {
+			t.Errorf("Got a prediction for unknown text: %s with %f", category, confidence)
+		}
+	})
+	t.Run("Empty models predict nothing", func(t *testing.T) {
+		if category, _ := Train(nil).Predict("REWE"); category != "" {
+			t.Errorf("Empty model predicted %s", category)
+		}
+	})
+}
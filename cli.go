@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/dbapi"
+)
+
+// Exit codes of the command line interface.
+const (
+	exitOK = 0
+	// exitFailure means a sync failed.
+	exitFailure = 1
+	// exitUsage means the arguments or configuration are invalid.
+	exitUsage = 2
+	// exitUnauthorized means we have to log in to the bank first.
+	exitUnauthorized = 3
+)
+
+// output is where commands print their results, so we can replace it in tests.
+var output io.Writer = os.Stdout
+
+// commands are the subcommands of the command line interface.
+var commands = map[string]func(args []string) int{
+	"serve":      serveCommand,
+	"sync":       syncCommand,
+	"backfill":   backfillCommand,
+	"authorize":  authorizeCommand,
+	"status":     statusCommand,
+	"history":    historyCommand,
+	"test-rules": testRulesCommand,
+}
+
+const usage string = `Usage: db-to-ynab <command> [flags]
+
+Commands:
+  serve       sync on HTTP requests and the configured schedule (default)
+  sync        sync once and exit
+  backfill    sync a range of past dates and exit
+  authorize   log in to the bank and save the token
+  status      show the token expiry and the last sync
+  history     show the recorded sync runs
+  test-rules  show which payee rule matches each payee given as an argument
+
+Run db-to-ynab <command> -h for the flags of a command.
+`
+
+// runCommand runs the subcommand in args and returns the exit code. Without a
+// subcommand, it serves HTTP requests.
+func runCommand(args []string) int {
+	if len(args) == 0 {
+		return serveCommand(args)
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+	return command(args[1:])
+}
+
+// newFlagSet returns a flag set for a subcommand, with the common -config flag.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&configFile, "config", configFile, "path of the YAML or TOML config file")
+	return flags
+}
+
+// setup loads the configuration, connectors and DB token for a one-off command.
+func setup() error {
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if err := electConnectors(); err != nil {
+		return err
+	}
+	return dbapi.LoadTokenStore()
+}
+
+// setupSync sets up a one-off command which posts transactions, and finds the
+// categories of the category rules in YNAB. It returns exitUsage for an invalid
+// configuration and exitFailure if YNAB cannot be reached.
+func setupSync() int {
+	if err := setup(); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if err := resolveCategories(); err != nil {
+		log.Print(err)
+		var unavailable *categoriesUnavailableError
+		if errors.As(err, &unavailable) {
+			return exitFailure
+		}
+		return exitUsage
+	}
+	return exitOK
+}
+
+func serveCommand(args []string) int {
+	if err := newFlagSet("serve").Parse(args); err != nil {
+		return exitUsage
+	}
+	serve()
+	return exitFailure
+}
+
+func syncCommand(args []string) int {
+	flags := newFlagSet("sync")
+	accountName := flags.String("account", "", "sync only the account with this name")
+	dryRunFlag := flags.Bool("dry-run", false, "show the transactions without posting them to YNAB")
+	format := flags.String("format", "table", "dry run output format, table or json")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" {
+		log.Printf("Unknown format %s, use table or json", *format)
+		return exitUsage
+	}
+	if exitCode := setupSync(); exitCode != exitOK {
+		return exitCode
+	}
+	if *dryRunFlag || dryRun {
+		return dryRunOnce(*accountName, nil, *format)
+	}
+	return syncOnce(*accountName)
+}
+
+// syncOnce syncs all accounts, or only the named one, and returns the exit code.
+func syncOnce(accountName string) int {
+	toSync, exitCode := accountsToSync(accountName)
+	if toSync == nil {
+		return exitCode
+	}
+	if err := runSync(toSync); err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// dryRunOnce prints what a sync of all accounts, or only the named one, would
+// post to YNAB and returns the exit code. With chunks, it previews a backfill.
+func dryRunOnce(accountName string, chunks []dateChunk, format string) int {
+	toSync, exitCode := accountsToSync(accountName)
+	if toSync == nil {
+		return exitCode
+	}
+	results, err := dryRunAccounts(toSync, chunks)
+	if format == "json" {
+		renderDryRunJSON(output, results)
+	} else {
+		renderDryRunTable(output, results)
+	}
+	if err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// accountsToSync returns all accounts, or only the named one, once we are
+// authorized. Otherwise it returns nil and the exit code.
+func accountsToSync(accountName string) ([]*syncAccount, int) {
+	toSync := accounts
+	if accountName != "" {
+		account := findAccount(accountName)
+		if account == nil {
+			log.Printf("No account named %s", accountName)
+			return nil, exitUsage
+		}
+		toSync = []*syncAccount{account}
+	}
+	if authorizeURL(toSync) != "" {
+		log.Print("We are not yet authorized, run the authorize command first")
+		return nil, exitUnauthorized
+	}
+	return toSync, exitOK
+}
+
+func authorizeCommand(args []string) int {
+	flags := newFlagSet("authorize")
+	listen := flags.String("listen", "", "address for the temporary listener, defaults to the host of the redirect base URL")
+	timeout := flags.Duration("timeout", 5*time.Minute, "how long to wait for the login")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := setup(); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if dbSettings.TokenFile == "" {
+		log.Print("No DB token file is set, set db.token_file to keep the token after authorizing")
+		return exitUsage
+	}
+	redirect, err := url.Parse(dbSettings.RedirectBaseURL + "authorized")
+	if err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	address := *listen
+	if address == "" {
+		address = listenAddress(redirect)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Printf("Cannot listen for the authorization response: %s", err)
+		return exitFailure
+	}
+	fmt.Fprintf(output, "Open this URL in a browser to log in to Deutsche Bank:\n\n%s\n\n", dbapi.AuthorizationURL())
+	if err := awaitAuthorization(listener, redirect.Path, *timeout); err != nil {
+		log.Printf("Authorization failed: %s", err)
+		return exitUnauthorized
+	}
+	fmt.Fprintln(output, "Authorized, the DB token is saved.")
+	return exitOK
+}
+
+// listenAddress returns the host and port of the redirect URL.
+func listenAddress(redirect *url.URL) string {
+	if redirect.Port() != "" {
+		return redirect.Host
+	}
+	if redirect.Scheme == "https" {
+		return redirect.Hostname() + ":443"
+	}
+	return redirect.Hostname() + ":80"
+}
+
+// awaitAuthorization serves the oauth response on path until it is received or
+// the timeout passes, and saves the token.
+func awaitAuthorization(listener net.Listener, path string, timeout time.Duration) error {
+	result := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		err := errors.New("Deutsche Bank returned an empty code")
+		if code := r.URL.Query().Get("code"); code != "" {
+			err = dbapi.UpdateToken(code)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			fmt.Fprint(w, "Authorized, you can close this window.")
+		}
+		select {
+		case result <- err:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("no response from Deutsche Bank within %s", timeout)
+	}
+}
+
+func statusCommand(args []string) int {
+	flags := newFlagSet("status")
+	server := flags.String("server", "", "base URL of the running sync server, defaults to the redirect base URL")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := setup(); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if *server == "" {
+		*server = dbSettings.RedirectBaseURL
+	}
+	return printStatus(*server)
+}
+
+// printStatus prints the DB token status and the last sync reported by the
+// server, and returns the exit code.
+func printStatus(server string) int {
+	exitCode := exitOK
+	if authorizeURL(accounts) != "" {
+		fmt.Fprintln(output, "DB token:  not authorized, run the authorize command")
+		exitCode = exitUnauthorized
+	} else {
+		fmt.Fprintf(output, "DB token:  authorized, access token expires %s\n", formatTime(dbapi.TokenExpiry()))
+	}
+	status, err := fetchStatus(server)
+	if err != nil {
+		fmt.Fprintf(output, "Last sync: unknown, cannot reach the sync server: %s\n", err)
+		return exitCode
+	}
+	switch {
+	case status.Running:
+		fmt.Fprintf(output, "Last sync: running since %s\n", formatTimePointer(status.LastRunStart))
+	case status.LastRunEnd == nil:
+		fmt.Fprintln(output, "Last sync: never")
+	case status.LastRunError != "":
+		fmt.Fprintf(output, "Last sync: failed at %s: %s\n", formatTimePointer(status.LastRunEnd), status.LastRunError)
+	default:
+		fmt.Fprintf(output, "Last sync: succeeded at %s\n", formatTimePointer(status.LastRunEnd))
+	}
+	if status.NextRun != nil {
+		fmt.Fprintf(output, "Next sync: %s\n", formatTimePointer(status.NextRun))
+	}
+	return exitCode
+}
+
+// fetchStatus gets the sync status from a running server.
+func fetchStatus(server string) (*statusResponse, error) {
+	response, err := http.Get(server + "status")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status request returned code %d", response.StatusCode)
+	}
+	var status statusResponse
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format(time.RFC1123)
+}
+
+func formatTimePointer(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return formatTime(*t)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/dbapi"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestRunCommand(t *testing.T) {
+	t.Run("Unknown commands are a usage error", func(t *testing.T) {
+		if got := runCommand([]string{"frobnicate"}); got != exitUsage {
+			t.Errorf("Got wrong exit code. Got %d want %d", got, exitUsage)
+		}
+	})
+	t.Run("Unknown flags are a usage error", func(t *testing.T) {
+		if got := runCommand([]string{"sync", "-frobnicate"}); got != exitUsage {
+			t.Errorf("Got wrong exit code. Got %d want %d", got, exitUsage)
+		}
+	})
+}
+
+func TestSyncOnce(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	t.Run("Sync without authorization", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("We are not yet authorized, run the authorize command first")
+		assertExitCode(t, exitUnauthorized, syncOnce(""))
+		testLogBuffer.TestLogValues(t)
+	})
+	testConnectorAuthorizeResponse = ""
+	setDummyYnabData()
+	t.Run("Successful sync", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Syncing account default")
+		testLogBuffer.ExpectLog("Received 0 transactions from bank")
+		testLogBuffer.ExpectLog("Ending run")
+		assertExitCode(t, exitOK, syncOnce("default"))
+		testLogBuffer.TestLogValues(t)
+	})
+	t.Run("Failed sync", func(t *testing.T) {
+		testConnectorGetTransactionsResponseError = errors.New("This is a test error")
+		defer func() { testConnectorGetTransactionsResponseError = nil }()
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Syncing account default")
+		testLogBuffer.ExpectLog("Failed to get bank transactions: This is a test error")
+		testLogBuffer.ExpectLog("failed syncing accounts: default")
+		assertExitCode(t, exitFailure, syncOnce(""))
+		testLogBuffer.TestLogValues(t)
+	})
+	t.Run("Sync an unknown account", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("No account named checking")
+		assertExitCode(t, exitUsage, syncOnce("checking"))
+		testLogBuffer.TestLogValues(t)
+	})
+}
+
+func TestAwaitAuthorization(t *testing.T) {
+	defer gock.Off()
+	dbapi.Configure(config.DB{ClientID: "client-id", ClientSecret: "client-secret", APIBaseURL: "https://example.com/"})
+	// Requests to our own listener must not be intercepted by gock.
+	client := &http.Client{Transport: &http.Transport{}}
+	t.Run("The token is saved when the response arrives", func(t *testing.T) {
+		gock.New("https://example.com/").
+			Post("/gw/oidc/token").
+			Reply(200).
+			JSON(map[string]interface{}{"access_token": "ACCESS_TOKEN", "refresh_token": "REFRESH_TOKEN", "token_type": "bearer", "expires_in": 600})
+		listener := newTestListener(t)
+		result := make(chan error)
+		go func() { result <- awaitAuthorization(listener, "/authorized", time.Second) }()
+		response, err := client.Get("http://" + listener.Addr().String() + "/authorized?code=CODE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		AssertStatus(t, http.StatusOK, response.StatusCode)
+		if err := <-result; err != nil {
+			t.Errorf("Unexpected error awaiting authorization: %s", err)
+		}
+		if dbapi.Authorize() != "" {
+			t.Error("Token was not saved after authorizing")
+		}
+	})
+	t.Run("An empty code fails", func(t *testing.T) {
+		listener := newTestListener(t)
+		result := make(chan error)
+		go func() { result <- awaitAuthorization(listener, "/authorized", time.Second) }()
+		response, err := client.Get("http://" + listener.Addr().String() + "/authorized")
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		AssertStatus(t, http.StatusInternalServerError, response.StatusCode)
+		if err := <-result; err == nil {
+			t.Error("Empty code did not return an error")
+		}
+	})
+	t.Run("Authorization times out", func(t *testing.T) {
+		if err := awaitAuthorization(newTestListener(t), "/authorized", 10*time.Millisecond); err == nil {
+			t.Error("Authorization without a response did not time out")
+		}
+	})
+}
+
+func TestPrintStatus(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	defer func() { syncState = &syncStatus{}; output = os.Stdout }()
+	syncState = &syncStatus{}
+	server := httptest.NewServer(http.HandlerFunc(StatusHandler))
+	defer server.Close()
+	t.Run("Status without authorization or syncs", func(t *testing.T) {
+		got := &bytes.Buffer{}
+		output = got
+		assertExitCode(t, exitUnauthorized, printStatus(server.URL+"/"))
+		assertOutput(t, got.String(), "DB token:  not authorized, run the authorize command\nLast sync: never\n")
+	})
+	t.Run("Status after a failed sync", func(t *testing.T) {
+		testConnectorAuthorizeResponse = ""
+		syncState.begin()
+		syncState.end(errors.New("failed syncing accounts: default"))
+		got := &bytes.Buffer{}
+		output = got
+		assertExitCode(t, exitOK, printStatus(server.URL+"/"))
+		if !strings.Contains(got.String(), "DB token:  authorized") || !strings.Contains(got.String(), ": failed syncing accounts: default\n") {
+			t.Errorf("Got wrong status output: %q", got.String())
+		}
+	})
+	t.Run("Status without a server", func(t *testing.T) {
+		got := &bytes.Buffer{}
+		output = got
+		printStatus("http://127.0.0.1:1/")
+		if !strings.Contains(got.String(), "Last sync: unknown, cannot reach the sync server") {
+			t.Errorf("Got wrong status output: %q", got.String())
+		}
+	})
+}
+
+func TestSetupSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rulesFile := filepath.Join(dir, "rules.yaml")
+	ioutil.WriteFile(rulesFile, []byte("categories:\n  - category: Groceries\n    payee: rewe\n"), 0600)
+	configFile = ""
+	env := map[string]string{
+		"YNAB_SECRET":              dummyYnabSecret,
+		"DB_CLIENT_ID":             "client-id",
+		"DB_CLIENT_SECRET":         "client-secret",
+		"DB_API_ENDPOINT_HOSTNAME": "https://example.com/",
+		"REDIRECT_BASE_URL":        "http://localhost:3000/",
+		"DB_ACCOUNT":               goodIban,
+		"YNAB_BUDGET_ID":           dummyYnabBudgetID,
+		"YNAB_ACCOUNT_ID":          dummyYnabAccountID,
+		"RULES_FILE":               rulesFile,
+	}
+	for variable, value := range env {
+		os.Setenv(variable, value)
+		defer os.Unsetenv(variable)
+	}
+	setDummyConnector(false)
+	defer resetTestConnectorResponses()
+	defer func() { categoryRules, categoryIDs = nil, nil }()
+	defer gock.Off()
+	t.Run("Commands which do not post transactions do not need YNAB", func(t *testing.T) {
+		if err := setup(); err != nil {
+			t.Errorf("Setup failed without YNAB: %s", err)
+		}
+	})
+	t.Run("YNAB failures are not usage errors", func(t *testing.T) {
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/categories").
+			Reply(500)
+		assertExitCode(t, exitFailure, setupSync())
+	})
+	t.Run("Unknown categories are usage errors", func(t *testing.T) {
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/categories").
+			Reply(200).
+			BodyString(`{"data":{"category_groups":[],"server_knowledge":1}}`)
+		assertExitCode(t, exitUsage, setupSync())
+	})
+}
+
+func newTestListener(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+func assertExitCode(t *testing.T, expect int, got int) {
+	if got != expect {
+		t.Errorf("Got wrong exit code. Got %d want %d", got, expect)
+	}
+}
+
+func assertOutput(t *testing.T, got string, expect string) {
+	if got != expect {
+		t.Errorf("Got wrong output. Got %q want %q", got, expect)
+	}
+}
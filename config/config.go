@@ -0,0 +1,602 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the application configuration, loaded from a YAML or TOML file and
+// overridden by environment variables.
+type Config struct {
+	YNAB     YNAB      `yaml:"ynab" toml:"ynab"`
+	DB       DB        `yaml:"db" toml:"db"`
+	Accounts []Account `yaml:"accounts" toml:"accounts"`
+	Schedule Schedule  `yaml:"schedule" toml:"schedule"`
+	// DryRun gets transactions from the bank without posting them to YNAB.
+	DryRun bool `yaml:"dry_run" toml:"dry_run"`
+	// LookbackDays is how many days of transactions each sync gets. Accounts
+	// can override it. Defaults to DefaultLookbackDays.
+	LookbackDays int `yaml:"lookback_days" toml:"lookback_days"`
+	// RulesFile is a YAML or TOML file of payee rules. A relative path is
+	// relative to the config file.
+	RulesFile string `yaml:"rules_file" toml:"rules_file"`
+	// Categorizer suggests categories for transactions no rule categorized.
+	Categorizer Categorizer `yaml:"categorizer" toml:"categorizer"`
+	// SettlementDays is how many days apart the card and cash sides of a
+	// credit card settlement may be booked. Defaults to DefaultSettlementDays.
+	SettlementDays int `yaml:"settlement_days" toml:"settlement_days"`
+	// SettlementReference is a regular expression which the counterparty,
+	// payment reference or creditor ID of the cash side of a credit card
+	// settlement matches. Defaults to DefaultSettlementReference.
+	SettlementReference string `yaml:"settlement_reference" toml:"settlement_reference"`
+	// BalanceCheck compares the bank balance of each account with YNAB.
+	BalanceCheck BalanceCheck `yaml:"balance_check" toml:"balance_check"`
+	// History records every sync run.
+	History History `yaml:"history" toml:"history"`
+
+	// file is the path the configuration was loaded from.
+	file string
+	// lines maps each key to the line in file where it was set.
+	lines map[string]int
+	// envVars maps each key to the environment variable that overrode it.
+	envVars map[string]string
+}
+
+// YNAB holds the settings for the YNAB API.
+type YNAB struct {
+	Secret string `yaml:"secret" toml:"secret"`
+}
+
+// DB holds the settings for the Deutsche Bank API.
+type DB struct {
+	ClientID        string `yaml:"client_id" toml:"client_id"`
+	ClientSecret    string `yaml:"client_secret" toml:"client_secret"`
+	APIBaseURL      string `yaml:"api_base_url" toml:"api_base_url"`
+	RedirectBaseURL string `yaml:"redirect_base_url" toml:"redirect_base_url"`
+	// TokenFile is where the token is saved between runs. Empty keeps it in memory only.
+	TokenFile string `yaml:"token_file" toml:"token_file"`
+	// The token file is encrypted with a passphrase or the contents of a key file.
+	TokenKey     string `yaml:"token_key" toml:"token_key"`
+	TokenKeyFile string `yaml:"token_key_file" toml:"token_key_file"`
+	// The previous key is only used to open a token saved before a key rotation.
+	PreviousTokenKey     string `yaml:"previous_token_key" toml:"previous_token_key"`
+	PreviousTokenKeyFile string `yaml:"previous_token_key_file" toml:"previous_token_key_file"`
+}
+
+// Schedule holds the settings for syncing on a schedule. With neither a cron
+// expression nor an interval, accounts are only synced on HTTP requests.
+type Schedule struct {
+	// Cron is a standard five field cron expression, e.g. "0 7,19 * * *".
+	Cron string `yaml:"cron" toml:"cron"`
+	// Interval is a fixed duration between syncs, e.g. "12h".
+	Interval string `yaml:"interval" toml:"interval"`
+	// Jitter is the maximum random delay added to each scheduled sync, e.g. "10m".
+	Jitter string `yaml:"jitter" toml:"jitter"`
+}
+
+// Account is a bank account to sync, and the YNAB account to sync it to.
+type Account struct {
+	// Name identifies the account in logs and URLs.
+	Name string `yaml:"name" toml:"name"`
+	// Number is the bank account number, e.g. an IBAN.
+	Number        string `yaml:"account_number" toml:"account_number"`
+	YNABBudgetID  string `yaml:"ynab_budget_id" toml:"ynab_budget_id"`
+	YNABAccountID string `yaml:"ynab_account_id" toml:"ynab_account_id"`
+	// LookbackDays overrides the global lookback_days for this account.
+	LookbackDays int `yaml:"lookback_days" toml:"lookback_days"`
+	// ImportIDFormat is "hash" (the default) or "ynab", to match transactions
+	// imported with YNAB's own file import.
+	ImportIDFormat string `yaml:"import_id_format" toml:"import_id_format"`
+	// PayeeTemplate and MemoTemplate are Go text/templates for the payee name
+	// and memo, with access to all bank fields, e.g. "{{.CounterPartyName}}".
+	PayeeTemplate string `yaml:"payee_template" toml:"payee_template"`
+	MemoTemplate  string `yaml:"memo_template" toml:"memo_template"`
+	// Currency is the ISO code of the YNAB account's currency. Defaults to
+	// DefaultCurrency.
+	Currency string `yaml:"currency" toml:"currency"`
+	// ExchangeRates convert transactions booked in another currency, as the
+	// value of one unit of that currency in Currency, e.g. USD: 0.92. Without a
+	// rate, such transactions are left out.
+	ExchangeRates map[string]float64 `yaml:"exchange_rates" toml:"exchange_rates"`
+	// ForeignCurrencyMemo is a template appended to the memo of transactions
+	// made in a foreign currency. Defaults to bank.DefaultForeignCurrencyMemo.
+	ForeignCurrencyMemo string `yaml:"foreign_currency_memo" toml:"foreign_currency_memo"`
+	// SyncPending posts pending card transactions as uncleared, and updates
+	// them once they are booked.
+	SyncPending bool `yaml:"sync_pending" toml:"sync_pending"`
+}
+
+// DefaultCurrency is the currency of YNAB accounts, unless configured otherwise.
+const DefaultCurrency string = "EUR"
+
+// currencyCode matches ISO 4217 currency codes.
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Categorizer holds the settings for suggesting categories, learned from the
+// categorized transactions already in each YNAB account.
+type Categorizer struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// MinConfidence is the probability from 0 to 1 a suggestion needs to be
+	// used. Defaults to DefaultMinConfidence.
+	MinConfidence float64 `yaml:"min_confidence" toml:"min_confidence"`
+	// HistoryDays is how many days of YNAB transactions to learn from.
+	// Defaults to DefaultHistoryDays.
+	HistoryDays int `yaml:"history_days" toml:"history_days"`
+}
+
+// BalanceCheck holds the settings for comparing the balance of each account at
+// the bank with its cleared balance in YNAB after a sync.
+type BalanceCheck struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Adjust creates a reconciliation adjustment in YNAB for any difference.
+	Adjust bool `yaml:"adjust" toml:"adjust"`
+}
+
+// History holds the settings for recording sync runs.
+type History struct {
+	// File is the history database. Empty records nothing. A relative path is
+	// relative to the config file.
+	File string `yaml:"file" toml:"file"`
+	// RetentionDays is how many days runs are kept. Defaults to
+	// DefaultRetentionDays.
+	RetentionDays int `yaml:"retention_days" toml:"retention_days"`
+}
+
+// DefaultRetentionDays is how many days sync runs are kept in the history,
+// unless configured otherwise.
+const DefaultRetentionDays int = 90
+
+// Categorizer defaults.
+const (
+	DefaultMinConfidence float64 = 0.8
+	DefaultHistoryDays   int     = 365
+)
+
+// DefaultAccountName is the name of the account configured by environment variables.
+const DefaultAccountName string = "default"
+
+// Import ID formats.
+const (
+	ImportIDFormatHash string = "hash"
+	ImportIDFormatYNAB string = "ynab"
+)
+
+// DefaultLookbackDays is how many days of transactions a sync gets, unless configured otherwise.
+const DefaultLookbackDays int = 10
+
+// DefaultSettlementDays is how many days apart the two sides of a credit card
+// settlement may be booked, unless configured otherwise.
+const DefaultSettlementDays int = 5
+
+// DefaultSettlementReference matches the cash side of a credit card settlement,
+// unless configured otherwise.
+const DefaultSettlementReference string = `(?i)kreditkart|credit ?card`
+
+// envOverrides are the environment variables which override config file values.
+var envOverrides = []struct {
+	variable string
+	key      string
+	field    func(*Config) *string
+}{
+	{"YNAB_SECRET", "ynab.secret", func(c *Config) *string { return &c.YNAB.Secret }},
+	{"DB_CLIENT_ID", "db.client_id", func(c *Config) *string { return &c.DB.ClientID }},
+	{"DB_CLIENT_SECRET", "db.client_secret", func(c *Config) *string { return &c.DB.ClientSecret }},
+	{"DB_API_ENDPOINT_HOSTNAME", "db.api_base_url", func(c *Config) *string { return &c.DB.APIBaseURL }},
+	{"REDIRECT_BASE_URL", "db.redirect_base_url", func(c *Config) *string { return &c.DB.RedirectBaseURL }},
+	{"DB_TOKEN_FILE", "db.token_file", func(c *Config) *string { return &c.DB.TokenFile }},
+	{"DB_TOKEN_KEY", "db.token_key", func(c *Config) *string { return &c.DB.TokenKey }},
+	{"DB_TOKEN_KEY_FILE", "db.token_key_file", func(c *Config) *string { return &c.DB.TokenKeyFile }},
+	{"DB_TOKEN_PREVIOUS_KEY", "db.previous_token_key", func(c *Config) *string { return &c.DB.PreviousTokenKey }},
+	{"DB_TOKEN_PREVIOUS_KEY_FILE", "db.previous_token_key_file", func(c *Config) *string { return &c.DB.PreviousTokenKeyFile }},
+	{"SYNC_CRON", "schedule.cron", func(c *Config) *string { return &c.Schedule.Cron }},
+	{"SYNC_INTERVAL", "schedule.interval", func(c *Config) *string { return &c.Schedule.Interval }},
+	{"SYNC_JITTER", "schedule.jitter", func(c *Config) *string { return &c.Schedule.Jitter }},
+	{"RULES_FILE", "rules_file", func(c *Config) *string { return &c.RulesFile }},
+	{"HISTORY_FILE", "history.file", func(c *Config) *string { return &c.History.File }},
+}
+
+// accountEnvOverrides are the environment variables which override values of the default account.
+var accountEnvOverrides = []struct {
+	variable string
+	key      string
+	field    func(*Account) *string
+}{
+	{"DB_ACCOUNT", "account_number", func(a *Account) *string { return &a.Number }},
+	{"YNAB_BUDGET_ID", "ynab_budget_id", func(a *Account) *string { return &a.YNABBudgetID }},
+	{"YNAB_ACCOUNT_ID", "ynab_account_id", func(a *Account) *string { return &a.YNABAccountID }},
+}
+
+// Load reads the configuration from a YAML or TOML file, and applies
+// environment variable overrides. With an empty path, only the environment is used.
+func Load(path string) (*Config, error) {
+	config := &Config{
+		file:    path,
+		lines:   make(map[string]int),
+		envVars: make(map[string]string),
+	}
+	if path != "" {
+		if err := decodeFile(path, config, config.lines); err != nil {
+			if _, located := err.(*Error); !located {
+				err = fmt.Errorf("cannot load config file %s: %w", path, err)
+			}
+			return nil, err
+		}
+		for _, file := range []*string{&config.RulesFile, &config.History.File} {
+			if *file != "" && !filepath.IsAbs(*file) {
+				*file = filepath.Join(filepath.Dir(path), *file)
+			}
+		}
+	}
+	config.applyEnv()
+	return config, nil
+}
+
+// decodeFile decodes a YAML or TOML file into target, refusing unknown keys,
+// and records the line of every key in lines.
+func decodeFile(path string, target interface{}, lines map[string]int) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return decodeYAML(contents, target, lines)
+	case ".toml":
+		return decodeTOML(path, contents, target, lines)
+	}
+	return fmt.Errorf("unsupported file type %s, use .yaml, .yml or .toml", filepath.Ext(path))
+}
+
+func decodeYAML(contents []byte, target interface{}, lines map[string]int) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(target); err != nil && err != io.EOF {
+		return err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(contents, &root); err != nil {
+		return err
+	}
+	recordYAMLLines(&root, "", lines)
+	return nil
+}
+
+// recordYAMLLines records the line of every key below node.
+func recordYAMLLines(node *yaml.Node, path string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			recordYAMLLines(child, path, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := joinKey(path, node.Content[i].Value)
+			lines[key] = node.Content[i].Line
+			recordYAMLLines(node.Content[i+1], key, lines)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			key := fmt.Sprintf("%s[%d]", path, i)
+			lines[key] = child.Line
+			recordYAMLLines(child, key, lines)
+		}
+	}
+}
+
+func decodeTOML(path string, contents []byte, target interface{}, lines map[string]int) error {
+	metadata, err := toml.Decode(string(contents), target)
+	if err != nil {
+		return err
+	}
+	recordTOMLLines(contents, lines)
+	if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+		key := undecoded[0].String()
+		return &Error{File: path, Line: lineOf(lines, key), Key: key, Message: "unknown setting"}
+	}
+	return nil
+}
+
+var (
+	tomlArrayTable = regexp.MustCompile(`^\[\[\s*([A-Za-z0-9_.-]+)\s*\]\]`)
+	tomlTable      = regexp.MustCompile(`^\[\s*([A-Za-z0-9_.-]+)\s*\]`)
+	tomlKey        = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=`)
+)
+
+// recordTOMLLines records the line of every table and key in a TOML document.
+// Keys in arrays of tables and their subtables are also recorded without the
+// index, as the TOML decoder reports them that way.
+func recordTOMLLines(contents []byte, lines map[string]int) {
+	table, arrayTable := "", ""
+	arrayLengths := make(map[string]int)
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if match := tomlArrayTable.FindStringSubmatch(line); match != nil {
+			if _, seen := lines[match[1]]; !seen {
+				lines[match[1]] = i + 1
+			}
+			table = fmt.Sprintf("%s[%d]", match[1], arrayLengths[match[1]])
+			arrayTable = match[1]
+			arrayLengths[match[1]]++
+			lines[table] = i + 1
+		} else if match := tomlTable.FindStringSubmatch(line); match != nil {
+			table, arrayTable = match[1], ""
+			// A subtable of an array of tables belongs to its last element.
+			if parent := strings.SplitN(match[1], ".", 2); len(parent) == 2 && arrayLengths[parent[0]] > 0 {
+				table = fmt.Sprintf("%s[%d].%s", parent[0], arrayLengths[parent[0]]-1, parent[1])
+				arrayTable = match[1]
+			}
+			lines[table] = i + 1
+		} else if match := tomlKey.FindStringSubmatch(line); match != nil {
+			lines[joinKey(table, match[1])] = i + 1
+			if _, seen := lines[joinKey(arrayTable, match[1])]; arrayTable != "" && !seen {
+				lines[joinKey(arrayTable, match[1])] = i + 1
+			}
+		}
+	}
+}
+
+// applyEnv overrides config values with any environment variables that are set.
+// The account variables apply to the account named "default", which is created
+// if the config file has no accounts.
+func (c *Config) applyEnv() {
+	for _, override := range envOverrides {
+		if value := os.Getenv(override.variable); value != "" {
+			*override.field(c) = value
+			c.envVars[override.key] = override.variable
+		}
+	}
+	for _, override := range accountEnvOverrides {
+		value := os.Getenv(override.variable)
+		if value == "" {
+			continue
+		}
+		index := c.defaultAccountIndex()
+		if index < 0 {
+			continue
+		}
+		*override.field(&c.Accounts[index]) = value
+		c.envVars[fmt.Sprintf("accounts[%d].%s", index, override.key)] = override.variable
+	}
+}
+
+// defaultAccountIndex returns the index of the default account, creating it if
+// there are no accounts. It returns -1 if only other accounts are configured.
+func (c *Config) defaultAccountIndex() int {
+	for i, account := range c.Accounts {
+		if account.Name == DefaultAccountName {
+			return i
+		}
+	}
+	if len(c.Accounts) > 0 {
+		return -1
+	}
+	c.Accounts = append(c.Accounts, Account{Name: DefaultAccountName})
+	return 0
+}
+
+// Validate checks that all required values are set and consistent.
+func (c *Config) Validate() error {
+	required := []struct {
+		key   string
+		value string
+	}{
+		{"ynab.secret", c.YNAB.Secret},
+		{"db.client_id", c.DB.ClientID},
+		{"db.client_secret", c.DB.ClientSecret},
+		{"db.api_base_url", c.DB.APIBaseURL},
+		{"db.redirect_base_url", c.DB.RedirectBaseURL},
+	}
+	for _, param := range required {
+		if param.value == "" {
+			return c.missingValueError(param.key)
+		}
+	}
+	if c.DB.TokenKey != "" && c.DB.TokenKeyFile != "" {
+		return c.errorf("db.token_key_file", "set only one of token_key and token_key_file")
+	}
+	if c.DB.PreviousTokenKey != "" && c.DB.PreviousTokenKeyFile != "" {
+		return c.errorf("db.previous_token_key_file", "set only one of previous_token_key and previous_token_key_file")
+	}
+	if c.DB.TokenKey == "" && c.DB.TokenKeyFile == "" && (c.DB.PreviousTokenKey != "" || c.DB.PreviousTokenKeyFile != "") {
+		return c.errorf("db.previous_token_key", "a previous token key is set without a current one")
+	}
+	if err := c.validateSchedule(); err != nil {
+		return err
+	}
+	if c.LookbackDays < 0 {
+		return c.errorf("lookback_days", "lookback_days must not be negative")
+	}
+	if c.Categorizer.MinConfidence < 0 || c.Categorizer.MinConfidence > 1 {
+		return c.errorf("categorizer.min_confidence", "min_confidence must be between 0 and 1")
+	}
+	if c.Categorizer.HistoryDays < 0 {
+		return c.errorf("categorizer.history_days", "history_days must not be negative")
+	}
+	if c.BalanceCheck.Adjust && !c.BalanceCheck.Enabled {
+		return c.errorf("balance_check.adjust", "adjust is set without enabling the balance check")
+	}
+	if c.History.RetentionDays < 0 {
+		return c.errorf("history.retention_days", "retention_days must not be negative")
+	}
+	if c.SettlementDays < 0 {
+		return c.errorf("settlement_days", "settlement_days must not be negative")
+	}
+	if _, err := regexp.Compile(c.SettlementReference); err != nil {
+		return c.errorf("settlement_reference", "invalid regular expression: %s", err)
+	}
+	return c.validateAccounts()
+}
+
+func (c *Config) validateSchedule() error {
+	schedule := c.Schedule
+	if schedule.Cron != "" && schedule.Interval != "" {
+		return c.errorf("schedule.interval", "set only one of cron and interval")
+	}
+	if schedule.Cron != "" {
+		if _, err := cron.ParseStandard(schedule.Cron); err != nil {
+			return c.errorf("schedule.cron", "invalid cron expression: %s", err)
+		}
+	}
+	if schedule.Interval != "" {
+		interval, err := time.ParseDuration(schedule.Interval)
+		if err != nil {
+			return c.errorf("schedule.interval", "invalid duration: %s", err)
+		}
+		if interval <= 0 {
+			return c.errorf("schedule.interval", "interval must be positive")
+		}
+	}
+	if schedule.Jitter != "" {
+		if schedule.Cron == "" && schedule.Interval == "" {
+			return c.errorf("schedule.jitter", "jitter is set without a cron expression or interval")
+		}
+		jitter, err := time.ParseDuration(schedule.Jitter)
+		if err != nil {
+			return c.errorf("schedule.jitter", "invalid duration: %s", err)
+		}
+		if jitter < 0 {
+			return c.errorf("schedule.jitter", "jitter must not be negative")
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateAccounts() error {
+	if len(c.Accounts) == 0 {
+		return c.errorf("accounts", "no accounts configured, cannot proceed without an account to sync")
+	}
+	names := make(map[string]bool)
+	for i, account := range c.Accounts {
+		required := []struct {
+			key   string
+			value string
+		}{
+			{"name", account.Name},
+			{"account_number", account.Number},
+			{"ynab_budget_id", account.YNABBudgetID},
+			{"ynab_account_id", account.YNABAccountID},
+		}
+		for _, param := range required {
+			if param.value == "" {
+				return c.missingValueError(fmt.Sprintf("accounts[%d].%s", i, param.key))
+			}
+		}
+		if account.LookbackDays < 0 {
+			return c.errorf(fmt.Sprintf("accounts[%d].lookback_days", i), "lookback_days must not be negative")
+		}
+		if format := account.ImportIDFormat; format != "" && format != ImportIDFormatHash && format != ImportIDFormatYNAB {
+			return c.errorf(fmt.Sprintf("accounts[%d].import_id_format", i), "unknown import ID format %s, use %s or %s", format, ImportIDFormatHash, ImportIDFormatYNAB)
+		}
+		templates := []struct {
+			key  string
+			text string
+		}{
+			{"payee_template", account.PayeeTemplate},
+			{"memo_template", account.MemoTemplate},
+			{"foreign_currency_memo", account.ForeignCurrencyMemo},
+		}
+		for _, param := range templates {
+			if _, err := bank.ParseTemplate(param.key, param.text); err != nil {
+				return c.errorf(fmt.Sprintf("accounts[%d].%s", i, param.key), "invalid template: %s", err)
+			}
+		}
+		if account.Currency != "" && !currencyCode.MatchString(account.Currency) {
+			return c.errorf(fmt.Sprintf("accounts[%d].currency", i), "invalid currency %s, use an ISO code like EUR", account.Currency)
+		}
+		currencies := make([]string, 0, len(account.ExchangeRates))
+		for currency := range account.ExchangeRates {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+		for _, currency := range currencies {
+			key := fmt.Sprintf("accounts[%d].exchange_rates.%s", i, currency)
+			if !currencyCode.MatchString(currency) {
+				return c.errorf(key, "invalid currency %s, use an ISO code like USD", currency)
+			}
+			if account.ExchangeRates[currency] <= 0 {
+				return c.errorf(key, "exchange rate must be greater than 0")
+			}
+		}
+		if names[account.Name] {
+			return c.errorf(fmt.Sprintf("accounts[%d].name", i), "account name %s is used more than once, account names must be unique", account.Name)
+		}
+		names[account.Name] = true
+	}
+	return nil
+}
+
+// Error is a configuration error, pointing to the offending key.
+type Error struct {
+	File    string
+	Line    int
+	Key     string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, e.Key, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// errorf returns an Error for key, locating it in the config file or the environment.
+func (c *Config) errorf(key string, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	if variable, ok := c.envVars[key]; ok {
+		return &Error{Key: key, Message: message + fmt.Sprintf(" (set by environment variable %s)", variable)}
+	}
+	return &Error{File: c.file, Line: c.line(key), Key: key, Message: message}
+}
+
+// missingValueError returns an Error for a required key without a value.
+func (c *Config) missingValueError(key string) error {
+	for _, override := range envOverrides {
+		if override.key == key {
+			return c.errorf(key, "missing value, set it in the config file or with the %s environment variable", override.variable)
+		}
+	}
+	return c.errorf(key, "missing value")
+}
+
+// line returns the line where key, or its closest parent, was set.
+func (c *Config) line(key string) int {
+	return lineOf(c.lines, key)
+}
+
+func lineOf(lines map[string]int, key string) int {
+	for key != "" {
+		if line, ok := lines[key]; ok {
+			return line
+		}
+		key = parentKey(key)
+	}
+	return 0
+}
+
+func joinKey(parent string, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func parentKey(key string) string {
+	if i := strings.LastIndexAny(key, ".["); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const yamlConfig string = `ynab:
+  secret: ynab-secret
+db:
+  client_id: client-id
+  client_secret: client-secret
+  api_base_url: https://simulator-api.db.com/
+  redirect_base_url: http://localhost:3000/
+accounts:
+  - name: checking
+    account_number: DE49500105178844289951
+    ynab_budget_id: budget-id
+    ynab_account_id: checking-id
+  - name: card
+    account_number: "1599"
+    ynab_budget_id: budget-id
+    ynab_account_id: card-id
+`
+
+const tomlConfig string = `[ynab]
+secret = "ynab-secret"
+
+[db]
+client_id = "client-id"
+client_secret = "client-secret"
+api_base_url = "https://simulator-api.db.com/"
+redirect_base_url = "http://localhost:3000/"
+
+[[accounts]]
+name = "checking"
+account_number = "DE49500105178844289951"
+ynab_budget_id = "budget-id"
+ynab_account_id = "checking-id"
+
+[[accounts]]
+name = "card"
+account_number = "1599"
+ynab_budget_id = "budget-id"
+ynab_account_id = "card-id"
+`
+
+var expectedAccounts = []Account{
+	{Name: "checking", Number: "DE49500105178844289951", YNABBudgetID: "budget-id", YNABAccountID: "checking-id"},
+	{Name: "card", Number: "1599", YNABBudgetID: "budget-id", YNABAccountID: "card-id"},
+}
+
+func TestLoad(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	for name, contents := range map[string]string{"config.yaml": yamlConfig, "config.toml": tomlConfig} {
+		t.Run("Load "+name, func(t *testing.T) {
+			config, err := Load(writeFile(t, dir, name, contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := config.Validate(); err != nil {
+				t.Errorf("Valid config returned an error: %s", err)
+			}
+			if config.YNAB.Secret != "ynab-secret" || config.DB.ClientID != "client-id" || config.DB.APIBaseURL != "https://simulator-api.db.com/" {
+				t.Errorf("Loaded wrong settings: %+v", config)
+			}
+			assertAccounts(t, config.Accounts, expectedAccounts)
+		})
+	}
+	t.Run("Unknown settings are refused", func(t *testing.T) {
+		_, err := Load(writeFile(t, dir, "unknown.yaml", yamlConfig+"schedule: daily\n"))
+		assertErrorContains(t, err, "line 17")
+		_, err = Load(writeFile(t, dir, "unknown.toml", tomlConfig+"color = \"red\"\n"))
+		assertErrorContains(t, err, "unknown.toml:21: accounts.color: unknown setting")
+	})
+	t.Run("Unsupported file types are refused", func(t *testing.T) {
+		_, err := Load(writeFile(t, dir, "config.ini", ""))
+		assertErrorContains(t, err, "unsupported file type .ini")
+	})
+}
+
+func TestEnvOverrides(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	t.Run("Environment variables override the config file", func(t *testing.T) {
+		setEnv(t, "YNAB_SECRET", "env-secret")
+		setEnv(t, "DB_TOKEN_FILE", "/data/token.json")
+		config, err := Load(writeFile(t, dir, "config.yaml", yamlConfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.YNAB.Secret != "env-secret" || config.DB.TokenFile != "/data/token.json" {
+			t.Errorf("Environment did not override the config file: %+v", config)
+		}
+		assertAccounts(t, config.Accounts, expectedAccounts)
+	})
+	t.Run("Account variables create a default account", func(t *testing.T) {
+		setEnv(t, "DB_ACCOUNT", "1599")
+		setEnv(t, "YNAB_BUDGET_ID", "budget-id")
+		setEnv(t, "YNAB_ACCOUNT_ID", "account-id")
+		config, err := Load("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertAccounts(t, config.Accounts, []Account{
+			{Name: DefaultAccountName, Number: "1599", YNABBudgetID: "budget-id", YNABAccountID: "account-id"},
+		})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	t.Run("Missing values point to the account", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "missing.yaml", strings.Replace(yamlConfig, "    ynab_account_id: card-id\n", "", 1)))
+		assertErrorContains(t, config.Validate(), "missing.yaml:13: accounts[1].ynab_account_id: missing value")
+	})
+	t.Run("Missing values suggest the environment variable", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "missing.toml", strings.Replace(tomlConfig, "client_secret = \"client-secret\"\n", "", 1)))
+		assertErrorContains(t, config.Validate(), "missing.toml:4: db.client_secret: missing value, set it in the config file or with the DB_CLIENT_SECRET environment variable")
+	})
+	t.Run("Duplicate account names point to the line", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "duplicate.yaml", strings.Replace(yamlConfig, "name: card", "name: checking", 1)))
+		assertErrorContains(t, config.Validate(), "duplicate.yaml:13: accounts[1].name: account name checking is used more than once")
+	})
+	t.Run("Values from the environment point to the variable", func(t *testing.T) {
+		setEnv(t, "DB_TOKEN_KEY", "passphrase")
+		config, _ := Load(writeFile(t, dir, "keys.yaml", strings.Replace(yamlConfig, "db:\n", "db:\n  token_key_file: /data/key\n", 1)))
+		assertErrorContains(t, config.Validate(), "keys.yaml:4: db.token_key_file: set only one of token_key and token_key_file")
+	})
+	t.Run("Invalid schedules point to the line", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "schedule.yaml", yamlConfig+"schedule:\n  cron: every day\n"))
+		assertErrorContains(t, config.Validate(), "schedule.yaml:18: schedule.cron: invalid cron expression")
+		config, _ = Load(writeFile(t, dir, "schedule.toml", "[schedule]\ninterval = \"12h\"\njitter = \"soon\"\n\n"+tomlConfig))
+		assertErrorContains(t, config.Validate(), "schedule.toml:3: schedule.jitter: invalid duration")
+		config, _ = Load(writeFile(t, dir, "both.yaml", yamlConfig+"schedule:\n  cron: \"0 7 * * *\"\n  interval: 12h\n"))
+		assertErrorContains(t, config.Validate(), "both.yaml:19: schedule.interval: set only one of cron and interval")
+	})
+	t.Run("Invalid categorizer settings point to the line", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "categorizer.yaml", yamlConfig+"categorizer:\n  enabled: true\n  min_confidence: 80\n"))
+		assertErrorContains(t, config.Validate(), "categorizer.yaml:19: categorizer.min_confidence: min_confidence must be between 0 and 1")
+	})
+	t.Run("Negative history retention points to the line", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "history.yaml", yamlConfig+"history:\n  file: history.db\n  retention_days: -1\n"))
+		assertErrorContains(t, config.Validate(), "history.yaml:19: history.retention_days: retention_days must not be negative")
+		if expect := filepath.Join(dir, "history.db"); config.History.File != expect {
+			t.Errorf("Got wrong history file. Got %s want %s", config.History.File, expect)
+		}
+	})
+	t.Run("Invalid settlement references point to the line", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "settlement.yaml", yamlConfig+"settlement_reference: \"(kreditkarte\"\n"))
+		assertErrorContains(t, config.Validate(), "settlement.yaml:17: settlement_reference: invalid regular expression")
+	})
+	t.Run("Negative lookbacks point to the account", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "lookback.yaml", strings.Replace(yamlConfig, "    ynab_account_id: card-id\n", "    ynab_account_id: card-id\n    lookback_days: -5\n", 1)))
+		assertErrorContains(t, config.Validate(), "lookback.yaml:17: accounts[1].lookback_days: lookback_days must not be negative")
+	})
+	t.Run("Unknown import ID formats point to the account", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "importid.toml", tomlConfig+"import_id_format = \"csv\"\n"))
+		assertErrorContains(t, config.Validate(), "importid.toml:21: accounts[1].import_id_format: unknown import ID format csv, use hash or ynab")
+	})
+	t.Run("Invalid templates point to the account", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "template.yaml", strings.Replace(yamlConfig, "    ynab_account_id: card-id\n", "    ynab_account_id: card-id\n    memo_template: \"{{.Reference}}\"\n", 1)))
+		assertErrorContains(t, config.Validate(), "template.yaml:17: accounts[1].memo_template: invalid template")
+		config, _ = Load(writeFile(t, dir, "template.toml", tomlConfig+"payee_template = \"{{.CounterPartyName\"\n"))
+		assertErrorContains(t, config.Validate(), "template.toml:21: accounts[1].payee_template: invalid template")
+	})
+	t.Run("Invalid exchange rates point to the account", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "currency.yaml", yamlConfig+"    currency: euro\n"))
+		assertErrorContains(t, config.Validate(), "currency.yaml:17: accounts[1].currency: invalid currency euro, use an ISO code like EUR")
+		config, _ = Load(writeFile(t, dir, "rates.toml", tomlConfig+"\n[accounts.exchange_rates]\nUSD = 0.92\nGBP = -1.1\n"))
+		assertErrorContains(t, config.Validate(), "rates.toml:24: accounts[1].exchange_rates.GBP: exchange rate must be greater than 0")
+	})
+	t.Run("No accounts fail", func(t *testing.T) {
+		config, _ := Load(writeFile(t, dir, "noaccounts.yaml", yamlConfig[:strings.Index(yamlConfig, "accounts:")]))
+		assertErrorContains(t, config.Validate(), "accounts: no accounts configured")
+	})
+}
+
+func createTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, dir string, name string, contents string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setEnv sets an environment variable until the end of the test.
+func setEnv(t *testing.T, variable string, value string) {
+	os.Setenv(variable, value)
+	t.Cleanup(func() { os.Unsetenv(variable) })
+}
+
+func assertAccounts(t *testing.T, got []Account, expect []Account) {
+	if len(got) != len(expect) {
+		t.Fatalf("Loaded wrong number of accounts. Got %d want %d", len(got), len(expect))
+	}
+	for i := range expect {
+		if !reflect.DeepEqual(got[i], expect[i]) {
+			t.Errorf("Loaded wrong account. Got %+v want %+v", got[i], expect[i])
+		}
+	}
+}
+
+func assertErrorContains(t *testing.T, err error, expect string) {
+	if err == nil {
+		t.Errorf("Expected an error containing %q, got none", expect)
+		return
+	}
+	if !strings.Contains(err.Error(), expect) {
+		t.Errorf("Got wrong error. Got %q want it to contain %q", err.Error(), expect)
+	}
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+)
+
+// Rules are the rules applied to transactions before they are posted to YNAB,
+// loaded from the file set as rules_file.
+type Rules struct {
+	// Payees map payee names from the bank to clean names. The first matching
+	// rule applies.
+	Payees []PayeeRule `yaml:"payees" toml:"payees"`
+	// Categories set the category of transactions which match all conditions
+	// of a rule. The first matching rule applies.
+	Categories []CategoryRule `yaml:"categories" toml:"categories"`
+	// Approve lists the transactions to approve, e.g. rent and salary.
+	Approve []ApproveRule `yaml:"approve" toml:"approve"`
+	// Flags set the flag color of transactions. The first matching rule applies.
+	Flags []FlagRule `yaml:"flags" toml:"flags"`
+
+	file  string
+	lines map[string]int
+}
+
+// PayeeRule renames payees which match one of Exact, Prefix or Regex. Exact and
+// prefix matches ignore case. Payee may refer to regex groups, e.g. "$1".
+type PayeeRule struct {
+	Exact  string `yaml:"exact" toml:"exact"`
+	Prefix string `yaml:"prefix" toml:"prefix"`
+	Regex  string `yaml:"regex" toml:"regex"`
+	Payee  string `yaml:"payee" toml:"payee"`
+	// Source is the file and line of the rule, for reporting which rule matched.
+	Source string `yaml:"-" toml:"-"`
+}
+
+// Conditions select the transactions a rule applies to. A transaction must
+// match all conditions which are set. Payee and Memo are regular expressions,
+// which ignore case. Amounts are in the account currency, negative for
+// outflows, and the range includes its limits.
+type Conditions struct {
+	Payee           string   `yaml:"payee" toml:"payee"`
+	Memo            string   `yaml:"memo" toml:"memo"`
+	MinAmount       *float64 `yaml:"min_amount" toml:"min_amount"`
+	MaxAmount       *float64 `yaml:"max_amount" toml:"max_amount"`
+	IBAN            string   `yaml:"iban" toml:"iban"`
+	CreditorID      string   `yaml:"creditor_id" toml:"creditor_id"`
+	Kind            string   `yaml:"kind" toml:"kind"`
+	TransactionCode string   `yaml:"transaction_code" toml:"transaction_code"`
+	DomainCode      string   `yaml:"domain_code" toml:"domain_code"`
+	FamilyCode      string   `yaml:"family_code" toml:"family_code"`
+	SubFamilyCode   string   `yaml:"sub_family_code" toml:"sub_family_code"`
+	// NewPayee matches payees which are not (true) or are (false) among the
+	// budget's payees yet.
+	NewPayee *bool `yaml:"new_payee" toml:"new_payee"`
+	// ForeignCurrency matches transactions which were (true) or were not
+	// (false) made in a foreign currency.
+	ForeignCurrency *bool `yaml:"foreign_currency" toml:"foreign_currency"`
+}
+
+// hasCondition checks if at least one condition is set, so a rule does not
+// match every transaction.
+func (c Conditions) hasCondition() bool {
+	for _, condition := range []string{c.Payee, c.Memo, c.IBAN, c.CreditorID, c.Kind, c.TransactionCode, c.DomainCode, c.FamilyCode, c.SubFamilyCode} {
+		if condition != "" {
+			return true
+		}
+	}
+	return c.MinAmount != nil || c.MaxAmount != nil || c.NewPayee != nil || c.ForeignCurrency != nil
+}
+
+// CategoryRule sets the category of transactions which match its conditions.
+// Category is the name of a YNAB category, optionally with its group, e.g.
+// "Everyday Expenses: Groceries".
+type CategoryRule struct {
+	Category   string `yaml:"category" toml:"category"`
+	Conditions `yaml:",inline"`
+	Source     string `yaml:"-" toml:"-"`
+}
+
+// ApproveRule approves transactions which match its conditions, so they do
+// not have to be reviewed in YNAB.
+type ApproveRule struct {
+	Conditions `yaml:",inline"`
+	Source     string `yaml:"-" toml:"-"`
+}
+
+// FlagRule sets the flag color of transactions which match its conditions.
+type FlagRule struct {
+	Color      string `yaml:"color" toml:"color"`
+	Conditions `yaml:",inline"`
+	Source     string `yaml:"-" toml:"-"`
+}
+
+// Flag colors YNAB supports.
+var flagColors = []string{"red", "orange", "yellow", "green", "blue", "purple"}
+
+// LoadRules reads and validates rules from a YAML or TOML file.
+func LoadRules(path string) (*Rules, error) {
+	rules := &Rules{file: path, lines: make(map[string]int)}
+	if err := decodeFile(path, rules, rules.lines); err != nil {
+		if _, located := err.(*Error); !located {
+			err = fmt.Errorf("cannot load rules file %s: %w", path, err)
+		}
+		return nil, err
+	}
+	for i := range rules.Payees {
+		rules.Payees[i].Source = rules.source(fmt.Sprintf("payees[%d]", i))
+	}
+	for i := range rules.Categories {
+		rules.Categories[i].Source = rules.source(fmt.Sprintf("categories[%d]", i))
+	}
+	for i := range rules.Approve {
+		rules.Approve[i].Source = rules.source(fmt.Sprintf("approve[%d]", i))
+	}
+	for i := range rules.Flags {
+		rules.Flags[i].Source = rules.source(fmt.Sprintf("flags[%d]", i))
+	}
+	if err := rules.validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (r *Rules) validate() error {
+	for i, rule := range r.Payees {
+		key := fmt.Sprintf("payees[%d]", i)
+		matchers := 0
+		for _, pattern := range []string{rule.Exact, rule.Prefix, rule.Regex} {
+			if pattern != "" {
+				matchers++
+			}
+		}
+		if matchers != 1 {
+			return r.errorf(key, "set exactly one of exact, prefix and regex")
+		}
+		if rule.Payee == "" {
+			return r.errorf(key+".payee", "missing value")
+		}
+		if rule.Regex != "" {
+			if _, err := regexp.Compile(rule.Regex); err != nil {
+				return r.errorf(key+".regex", "invalid regular expression: %s", err)
+			}
+		}
+	}
+	for i, rule := range r.Categories {
+		key := fmt.Sprintf("categories[%d]", i)
+		if rule.Category == "" {
+			return r.errorf(key+".category", "missing value")
+		}
+		if err := r.validateConditions(key, rule.Conditions); err != nil {
+			return err
+		}
+	}
+	for i, rule := range r.Approve {
+		if err := r.validateConditions(fmt.Sprintf("approve[%d]", i), rule.Conditions); err != nil {
+			return err
+		}
+	}
+	for i, rule := range r.Flags {
+		key := fmt.Sprintf("flags[%d]", i)
+		if !isFlagColor(rule.Color) {
+			return r.errorf(key+".color", "unknown flag color %q, use one of %s", rule.Color, strings.Join(flagColors, ", "))
+		}
+		if err := r.validateConditions(key, rule.Conditions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rules) validateConditions(key string, conditions Conditions) error {
+	if !conditions.hasCondition() {
+		return r.errorf(key, "no conditions, set at least one of payee, memo, min_amount, max_amount, iban, creditor_id, kind, new_payee, foreign_currency or a transaction code")
+	}
+	for _, pattern := range []struct {
+		key   string
+		value string
+	}{
+		{"payee", conditions.Payee},
+		{"memo", conditions.Memo},
+	} {
+		if _, err := regexp.Compile(pattern.value); err != nil {
+			return r.errorf(key+"."+pattern.key, "invalid regular expression: %s", err)
+		}
+	}
+	if conditions.MinAmount != nil && conditions.MaxAmount != nil && *conditions.MinAmount > *conditions.MaxAmount {
+		return r.errorf(key+".max_amount", "max_amount is less than min_amount")
+	}
+	switch conditions.Kind {
+	case "", bank.KindCard, bank.KindDirectDebit, bank.KindTransfer:
+	default:
+		return r.errorf(key+".kind", "unknown kind %s, use %s, %s or %s", conditions.Kind, bank.KindCard, bank.KindDirectDebit, bank.KindTransfer)
+	}
+	return nil
+}
+
+func isFlagColor(color string) bool {
+	for _, flagColor := range flagColors {
+		if color == flagColor {
+			return true
+		}
+	}
+	return false
+}
+
+// source returns the file and line of a rule.
+func (r *Rules) source(key string) string {
+	return fmt.Sprintf("%s:%d", r.file, lineOf(r.lines, key))
+}
+
+// errorf returns an Error for key, locating it in the rules file.
+func (r *Rules) errorf(key string, format string, args ...interface{}) error {
+	return &Error{File: r.file, Line: lineOf(r.lines, key), Key: key, Message: fmt.Sprintf(format, args...)}
+}
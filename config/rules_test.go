@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+const yamlRules string = `payees:
+  - exact: PAYPAL
+    payee: PayPal
+  - prefix: REWE SAGT DANKE
+    payee: Rewe
+  - regex: '^AMZN MKTP (\w+)'
+    payee: Amazon $1
+`
+
+const tomlRules string = `[[payees]]
+exact = "PAYPAL"
+payee = "PayPal"
+
+[[payees]]
+prefix = "REWE SAGT DANKE"
+payee = "Rewe"
+`
+
+func TestLoadRules(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	t.Run("Load YAML rules", func(t *testing.T) {
+		rules, err := LoadRules(writeFile(t, dir, "rules.yaml", yamlRules))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rules.Payees) != 3 || rules.Payees[2].Regex != `^AMZN MKTP (\w+)` || rules.Payees[2].Payee != "Amazon $1" {
+			t.Errorf("Loaded wrong payee rules: %+v", rules.Payees)
+		}
+		if rules.Payees[1].Source != dir+"/rules.yaml:4" {
+			t.Errorf("Got wrong rule source. Got %s want %s", rules.Payees[1].Source, dir+"/rules.yaml:4")
+		}
+	})
+	t.Run("Load TOML rules", func(t *testing.T) {
+		rules, err := LoadRules(writeFile(t, dir, "rules.toml", tomlRules))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rules.Payees) != 2 || rules.Payees[1].Prefix != "REWE SAGT DANKE" || rules.Payees[1].Source != dir+"/rules.toml:5" {
+			t.Errorf("Loaded wrong payee rules: %+v", rules.Payees)
+		}
+	})
+	t.Run("Load category rules", func(t *testing.T) {
+		rules, err := LoadRules(writeFile(t, dir, "categories.toml", tomlRules+"\n[[categories]]\ncategory = \"Everyday Expenses: Groceries\"\npayee = \"^rewe\"\nmax_amount = -10.5\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rules.Categories) != 1 || rules.Categories[0].MaxAmount == nil || *rules.Categories[0].MaxAmount != -10.5 || rules.Categories[0].Source != dir+"/categories.toml:9" {
+			t.Errorf("Loaded wrong category rules: %+v", rules.Categories)
+		}
+	})
+	t.Run("Invalid category rules point to the line", func(t *testing.T) {
+		_, err := LoadRules(writeFile(t, dir, "nocondition.yaml", yamlRules+"categories:\n  - category: Groceries\n"))
+		assertErrorContains(t, err, "nocondition.yaml:9: categories[0]: no conditions")
+		_, err = LoadRules(writeFile(t, dir, "range.yaml", yamlRules+"categories:\n  - category: Groceries\n    min_amount: -10\n    max_amount: -50\n"))
+		assertErrorContains(t, err, "range.yaml:11: categories[0].max_amount: max_amount is less than min_amount")
+		_, err = LoadRules(writeFile(t, dir, "kind.yaml", yamlRules+"categories:\n  - category: Groceries\n    kind: cheque\n"))
+		assertErrorContains(t, err, "kind.yaml:10: categories[0].kind: unknown kind cheque, use card, direct_debit or transfer")
+	})
+	t.Run("Load approve and flag rules", func(t *testing.T) {
+		rules, err := LoadRules(writeFile(t, dir, "review.yaml", yamlRules+"approve:\n  - iban: DE89370400440532013000\nflags:\n  - color: red\n    max_amount: -500\n  - color: orange\n    new_payee: true\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rules.Approve) != 1 || rules.Approve[0].IBAN != "DE89370400440532013000" {
+			t.Errorf("Loaded wrong approve rules: %+v", rules.Approve)
+		}
+		if len(rules.Flags) != 2 || rules.Flags[1].Color != "orange" || rules.Flags[1].NewPayee == nil || !*rules.Flags[1].NewPayee || rules.Flags[1].Source != dir+"/review.yaml:13" {
+			t.Errorf("Loaded wrong flag rules: %+v", rules.Flags)
+		}
+	})
+	t.Run("Invalid flag rules point to the line", func(t *testing.T) {
+		_, err := LoadRules(writeFile(t, dir, "color.yaml", yamlRules+"flags:\n  - color: pink\n    foreign_currency: true\n"))
+		assertErrorContains(t, err, `color.yaml:9: flags[0].color: unknown flag color "pink", use one of red, orange, yellow, green, blue, purple`)
+		_, err = LoadRules(writeFile(t, dir, "approve.yaml", yamlRules+"approve:\n  - memo: '(unclosed'\n"))
+		assertErrorContains(t, err, "approve.yaml:9: approve[0].memo: invalid regular expression")
+	})
+	t.Run("Invalid rules point to the line", func(t *testing.T) {
+		_, err := LoadRules(writeFile(t, dir, "both.yaml", yamlRules+"  - exact: DM\n    prefix: DM-DROGERIE\n    payee: dm\n"))
+		assertErrorContains(t, err, "both.yaml:8: payees[3]: set exactly one of exact, prefix and regex")
+		_, err = LoadRules(writeFile(t, dir, "regex.yaml", yamlRules+"  - regex: '(unclosed'\n    payee: Broken\n"))
+		assertErrorContains(t, err, "regex.yaml:8: payees[3].regex: invalid regular expression")
+		_, err = LoadRules(writeFile(t, dir, "payee.toml", tomlRules+"\n[[payees]]\nexact = \"DM\"\n"))
+		assertErrorContains(t, err, "payee.toml:9: payees[2].payee: missing value")
+		_, err = LoadRules(writeFile(t, dir, "unknown.yaml", yamlRules+"  - contains: DM\n    payee: dm\n"))
+		assertErrorContains(t, err, "line 8")
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+)
+
+// convertCurrencies converts transactions booked in another currency than the
+// YNAB account's with the account's exchange rates. The booked amount becomes
+// the foreign amount, so it shows in the memo. Transactions in a currency
+// without a rate are left out, YNAB would take their amount as is.
+func convertCurrencies(account *syncAccount, transactions []bank.Transaction) []bank.Transaction {
+	accountCurrency := account.Currency
+	if accountCurrency == "" {
+		accountCurrency = config.DefaultCurrency
+	}
+	kept := make([]bank.Transaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		currency := strings.ToUpper(transaction.Details.CurrencyCode)
+		if currency == "" || currency == accountCurrency {
+			kept = append(kept, transaction)
+			continue
+		}
+		rate, ok := account.ExchangeRates[currency]
+		if !ok {
+			log.Printf("Leaving out transaction of %s %s on %s, account %s is in %s and has no exchange rate for %s", transaction.Details.Amount, currency, transaction.Date.Format("2006-01-02"), account.Name, accountCurrency, currency)
+			continue
+		}
+		transaction.Amount = int64(math.Round(float64(transaction.Amount) * rate))
+		transaction.Details.ForeignAmount = transaction.Details.Amount
+		transaction.Details.ForeignCurrency = currency
+		transaction.Details.FxRate = strconv.FormatFloat(rate, 'f', -1, 64)
+		transaction.Details.Amount = formatMilliunits(transaction.Amount)
+		transaction.Details.CurrencyCode = accountCurrency
+		kept = append(kept, transaction)
+	}
+	return kept
+}
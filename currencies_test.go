@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"go.bmvs.io/ynab/api"
+)
+
+func TestGetTransactionsCurrencies(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	defer func() { accounts[0].ExchangeRates = nil }()
+	payee := "Hotel"
+	date, _ := api.DateFromString("2020-03-04")
+	setTransactions := func() {
+		testConnectorGetTransactionsResponse = []bank.Transaction{
+			{PayloadTransaction: ynabTransaction{Amount: -130470, PayeeName: &payee}, Details: bank.Details{Amount: "-130.47", CurrencyCode: "EUR", ForeignAmount: "-120.00", ForeignCurrency: "USD", FxRate: "0.9197"}},
+			{PayloadTransaction: ynabTransaction{Date: date, Amount: -100000, PayeeName: &payee}, Details: bank.Details{Amount: "-100.00", CurrencyCode: "GBP"}},
+		}
+	}
+	t.Run("Card transactions get the original amount in the memo", func(t *testing.T) {
+		setTransactions()
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Leaving out transaction of -100.00 GBP on 2020-03-04, account default is in EUR and has no exchange rate for GBP")
+		transactions, err := getTransactions(accounts[0], time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testLogBuffer.TestLogValues(t)
+		if len(transactions) != 1 {
+			t.Fatalf("Got wrong number of transactions. Got %d want 1", len(transactions))
+		}
+		if transactions[0].Memo == nil || *transactions[0].Memo != "(-120.00 USD at 0.9197)" {
+			t.Errorf("Got wrong memo. Got %v want (-120.00 USD at 0.9197)", transactions[0].Memo)
+		}
+	})
+	t.Run("Transactions in other currencies are converted with the exchange rates", func(t *testing.T) {
+		setTransactions()
+		accounts[0].ExchangeRates = map[string]float64{"GBP": 1.1712}
+		transactions, err := getTransactions(accounts[0], time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transactions) != 2 {
+			t.Fatalf("Got wrong number of transactions. Got %d want 2", len(transactions))
+		}
+		converted := transactions[1]
+		if converted.Amount != -117120 {
+			t.Errorf("Got wrong amount. Got %d want -117120", converted.Amount)
+		}
+		if converted.Memo == nil || *converted.Memo != "(-100.00 GBP at 1.1712)" {
+			t.Errorf("Got wrong memo. Got %v want (-100.00 GBP at 1.1712)", converted.Memo)
+		}
+	})
+}
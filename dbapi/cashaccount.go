@@ -1,13 +1,17 @@
 package dbapi
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/go-pascal/iban"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
 	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
 	"go.bmvs.io/ynab/api"
 	"go.bmvs.io/ynab/api/transaction"
@@ -15,30 +19,51 @@ import (
 
 type ynabTransaction = transaction.PayloadTransaction
 
-// DbCashTransactionsList is a list of cash transactions as returned by the DB API.
+// DbCashTransactionsList is a page of cash transactions as returned by the DB API.
 type DbCashTransactionsList struct {
+	TotalItems   int
+	Limit        int
+	Offset       int
 	Transactions []DbCashTransaction
 }
 
+// Cash transactions are requested in pages. After maxCashPages we stop, in case
+// the API keeps returning pages.
+var (
+	cashPageSize = 100
+	maxCashPages = 50
+)
+
 // DbCashTransaction represents a transaction from a cash account.
 type DbCashTransaction struct {
-	BookingDate      string
-	CounterPartyName string
-	PaymentReference string
-	ID               string
-	Amount           float32
+	BookingDate                          string
+	ValueDate                            string
+	CounterPartyName                     string
+	CounterPartyIban                     string
+	PaymentReference                     string
+	PaymentIdentification                string
+	MandateReference                     string
+	CreditorID                           string `json:"creditorId"`
+	E2EReference                         string `json:"e2eReference"`
+	TransactionCode                      string
+	ExternalBankTransactionDomainCode    string
+	ExternalBankTransactionFamilyCode    string
+	ExternalBankTransactionSubFamilyCode string
+	CurrencyCode                         string
+	ID                                   string
+	Amount                               json.Number
 }
 
-var ynabAccountID string = os.Getenv("YNAB_ACCOUNT_ID")
+// DbCashAccount is a cash account with its balance, as returned by the DB API.
+type DbCashAccount struct {
+	Iban           string
+	CurrencyCode   string
+	CurrentBalance json.Number
+}
 
 // DbCashConnector gets transactions from a DB Cash account and converts to YNAB format.
 type DbCashConnector struct{}
 
-// CheckParams ensures that all parameters are provided.
-func (connector DbCashConnector) CheckParams() error {
-	return CheckParams()
-}
-
 // IsValidAccountNumber validates that the account number can be processed by this interface.
 func (connector DbCashConnector) IsValidAccountNumber(accountNumber string) (bool, error) {
 	// Detect test account number.
@@ -49,22 +74,70 @@ func (connector DbCashConnector) IsValidAccountNumber(accountNumber string) (boo
 	return isCorrectIban, nil
 }
 
-// GetTransactions gets transactions from DB and returns them in YNAB format.
-func (connector DbCashConnector) GetTransactions(accountNumber string) ([]ynabTransaction, error) {
-	var transactions DbCashTransactionsList
-	params := url.Values{}
-	params.Add("limit", "100")
-	params.Add("bookingDateFrom", time.Now().AddDate(0, 0, -10).Format("2006-01-02"))
-	params.Add("sortBy", "bookingDate[DESC]")
-	params.Add("iban", accountNumber)
-	err := dbAPIRequest("gw/dbapi/banking/transactions/v2/?"+params.Encode(), &transactions)
+// GetTransactions gets transactions booked between from and to from DB and
+// returns them in YNAB format.
+func (connector DbCashConnector) GetTransactions(account config.Account, from time.Time, to time.Time) ([]bank.Transaction, error) {
+	transactions, err := connector.getCashTransactions(account.Number, from, to)
 	if err != nil {
 		return nil, err
 	}
-	ynabTransactions := connector.ConvertCashTransactionsToYNAB(transactions, ynabAccountID)
+	ynabTransactions := connector.ConvertCashTransactionsToYNAB(transactions, account.YNABAccountID)
 	return ynabTransactions, nil
 }
 
+// GetBalance gets the current balance of a cash account from DB, in milliunits.
+func (connector DbCashConnector) GetBalance(account config.Account) (int64, error) {
+	var cashAccounts []DbCashAccount
+	params := url.Values{}
+	params.Add("iban", account.Number)
+	if err := dbAPIRequest("gw/dbapi/banking/cashAccounts/v2/?"+params.Encode(), &cashAccounts); err != nil {
+		return 0, err
+	}
+	for _, cashAccount := range cashAccounts {
+		if tools.NormalizeIBAN(cashAccount.Iban) == tools.NormalizeIBAN(account.Number) {
+			return tools.ConvertToMilliunits(cashAccount.CurrentBalance.String())
+		}
+	}
+	return 0, fmt.Errorf("No cash account found with IBAN %s", account.Number)
+}
+
+// getCashTransactions gets all pages of transactions booked between from and to.
+func (connector DbCashConnector) getCashTransactions(accountNumber string, from time.Time, to time.Time) (DbCashTransactionsList, error) {
+	var transactions DbCashTransactionsList
+	pages := 0
+	for pages < maxCashPages {
+		var page DbCashTransactionsList
+		params := url.Values{}
+		params.Add("limit", strconv.Itoa(cashPageSize))
+		params.Add("offset", strconv.Itoa(len(transactions.Transactions)))
+		params.Add("bookingDateFrom", from.Format("2006-01-02"))
+		params.Add("bookingDateTo", to.Format("2006-01-02"))
+		params.Add("sortBy", "bookingDate[DESC]")
+		params.Add("iban", accountNumber)
+		err := dbAPIRequest("gw/dbapi/banking/transactions/v2/?"+params.Encode(), &page)
+		if err != nil {
+			return transactions, err
+		}
+		pages++
+		transactions.Transactions = append(transactions.Transactions, page.Transactions...)
+		transactions.TotalItems = page.TotalItems
+		if isLastCashPage(page, len(transactions.Transactions)) {
+			log.Printf("Fetched %d cash transactions in %d pages", len(transactions.Transactions), pages)
+			return transactions, nil
+		}
+	}
+	log.Printf("Fetched %d cash transactions in %d pages, stopped at the page limit. Older transactions in the window were not fetched, sync a shorter window", len(transactions.Transactions), pages)
+	return transactions, nil
+}
+
+// isLastCashPage checks if there are no more transactions after a page.
+func isLastCashPage(page DbCashTransactionsList, fetched int) bool {
+	if len(page.Transactions) < cashPageSize {
+		return true
+	}
+	return page.TotalItems > 0 && fetched >= page.TotalItems
+}
+
 // Authorize checks the current token and returns an authorization URL if necessary.
 func (connector DbCashConnector) Authorize() string {
 	return Authorize()
@@ -75,40 +148,83 @@ func (connector DbCashConnector) AuthorizedHandler(w http.ResponseWriter, r *htt
 	AuthorizedHandler(w, r)
 }
 
-// ConvertCashTransactionsToYNAB converts a JSON string of transactions to YNAB format.
-func (connector DbCashConnector) ConvertCashTransactionsToYNAB(incomingTransactions DbCashTransactionsList, ynabAccountID string) (convertedTransactions []ynabTransaction) {
+// ConvertCashTransactionsToYNAB converts a JSON string of transactions to YNAB
+// format. Transactions which cannot be converted are left out.
+func (connector DbCashConnector) ConvertCashTransactionsToYNAB(incomingTransactions DbCashTransactionsList, ynabAccountID string) (convertedTransactions []bank.Transaction) {
 	transactions := incomingTransactions.Transactions
-	resultChannel := make(chan ynabTransaction)
-	var convertedTransaction ynabTransaction
+	resultChannel := make(chan convertedTransaction)
 	defer close(resultChannel)
 	for _, transaction := range transactions {
 		go func(t DbCashTransaction) {
-			resultChannel <- connector.ConvertTransactionToYNAB(ynabAccountID, t)
+			converted, err := connector.ConvertTransactionToYNAB(ynabAccountID, t)
+			resultChannel <- convertedTransaction{converted, err}
 		}(transaction)
 	}
 	for i := 0; i < len(transactions); i++ {
-		convertedTransaction = <-resultChannel
-		convertedTransactions = append(convertedTransactions, convertedTransaction)
+		result := <-resultChannel
+		if result.err != nil {
+			log.Printf("Leaving out cash transaction %s: %s", result.transaction.Details.ID, result.err)
+			continue
+		}
+		convertedTransactions = append(convertedTransactions, result.transaction)
 	}
 	return convertedTransactions
 }
 
-// ConvertTransactionToYNAB converts a given transaction to YNAB format.
-func (connector DbCashConnector) ConvertTransactionToYNAB(accountNumber string, incomingTransaction DbCashTransaction) ynabTransaction {
+// convertedTransaction is the result of converting a transaction to YNAB format.
+type convertedTransaction struct {
+	transaction bank.Transaction
+	err         error
+}
+
+// ConvertTransactionToYNAB converts a given transaction to YNAB format. It
+// returns an error if the date or amount cannot be read.
+func (connector DbCashConnector) ConvertTransactionToYNAB(accountNumber string, incomingTransaction DbCashTransaction) (bank.Transaction, error) {
+	details := cashTransactionDetails(incomingTransaction)
 	date, err := api.DateFromString(incomingTransaction.BookingDate)
 	if err != nil {
-		log.Print(err)
+		return bank.Transaction{Details: details}, err
+	}
+	amount, err := tools.ConvertToMilliunits(incomingTransaction.Amount.String())
+	if err != nil {
+		return bank.Transaction{Details: details}, err
 	}
 	importID := tools.CreateImportID(incomingTransaction.ID)
 	transaction := ynabTransaction{
 		AccountID: accountNumber,
 		Date:      date,
-		Amount:    tools.ConvertToMilliunits(incomingTransaction.Amount),
+		Amount:    amount,
 		PayeeName: &incomingTransaction.CounterPartyName,
 		Memo:      &incomingTransaction.PaymentReference,
 		Cleared:   transaction.ClearingStatusCleared,
 		Approved:  false,
 		ImportID:  &importID,
 	}
-	return transaction
+	return bank.Transaction{
+		PayloadTransaction: transaction,
+		Details:            details,
+	}, nil
+}
+
+// cashTransactionDetails keeps the fields of a cash transaction which YNAB has
+// no place for.
+func cashTransactionDetails(incomingTransaction DbCashTransaction) bank.Details {
+	return bank.Details{
+		ID:                    incomingTransaction.ID,
+		BookingDate:           incomingTransaction.BookingDate,
+		ValueDate:             incomingTransaction.ValueDate,
+		Amount:                incomingTransaction.Amount.String(),
+		CurrencyCode:          incomingTransaction.CurrencyCode,
+		CounterPartyName:      incomingTransaction.CounterPartyName,
+		CounterPartyIBAN:      incomingTransaction.CounterPartyIban,
+		PaymentReference:      incomingTransaction.PaymentReference,
+		PaymentIdentification: incomingTransaction.PaymentIdentification,
+		MandateReference:      incomingTransaction.MandateReference,
+		CreditorID:            incomingTransaction.CreditorID,
+		E2EReference:          incomingTransaction.E2EReference,
+		TransactionCode:       incomingTransaction.TransactionCode,
+		DomainCode:            incomingTransaction.ExternalBankTransactionDomainCode,
+		FamilyCode:            incomingTransaction.ExternalBankTransactionFamilyCode,
+		SubFamilyCode:         incomingTransaction.ExternalBankTransactionSubFamilyCode,
+	}
 }
@@ -10,6 +10,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
 	"golang.org/x/oauth2"
 	"gopkg.in/h2non/gock.v1"
 )
@@ -32,8 +35,8 @@ func TestCashTransactions(t *testing.T) {
 		AccessToken: "ACCESS_TOKEN",
 		Expiry:      time.Now().AddDate(1, 0, 0),
 	}
-	// Set a dummy YNAB Budget ID.
-	ynabAccountID = "account-id"
+	// Set a dummy YNAB Account ID.
+	ynabAccountID := "account-id"
 	dbAPIBaseURL = "https://example.com/"
 
 	// Set the expected output transactions
@@ -48,11 +51,15 @@ func TestCashTransactions(t *testing.T) {
 			MatchParam("iban", goodIban).
 			ParamPresent("sortBy").
 			MatchParam("limit", "100").
+			MatchParam("bookingDateFrom", "2019-11-01").
+			MatchParam("bookingDateTo", "2019-11-10").
 			MatchHeader("Authorization", "^Bearer (.*)$").
 			Reply(200).
 			BodyString(cashTransactionsResponse)
-		result, _ := connector.GetTransactions(goodIban)
-		marshalledResult, _ := json.Marshal(result)
+		from := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2019, 11, 10, 0, 0, 0, 0, time.UTC)
+		result, _ := connector.GetTransactions(config.Account{Number: goodIban, YNABAccountID: ynabAccountID}, from, to)
+		marshalledResult, _ := json.Marshal(bank.Payloads(result))
 		stringResult := string(marshalledResult[:])
 		assertJSONStringContainsRecords(t, stringResult, expectedRecords)
 		assertJSONLengthFromRecords(t, stringResult, expectedRecords)
@@ -62,7 +69,7 @@ func TestCashTransactions(t *testing.T) {
 		var DbTransactionsList DbCashTransactionsList
 		json.Unmarshal(input, &DbTransactionsList)
 		converted := connector.ConvertCashTransactionsToYNAB(DbTransactionsList, ynabAccountID)
-		marshalledOutput, err := json.Marshal((converted))
+		marshalledOutput, err := json.Marshal(bank.Payloads(converted))
 		output := string(marshalledOutput)
 		if err != nil {
 			log.Fatal(err)
@@ -74,6 +81,93 @@ func TestCashTransactions(t *testing.T) {
 		assertJSONStringContainsRecords(t, output, expectedRecords)
 		assertJSONLengthFromRecords(t, output, expectedRecords)
 	})
+	t.Run("Bank details are kept with the converted transaction", func(t *testing.T) {
+		var DbTransactionsList DbCashTransactionsList
+		json.Unmarshal([]byte(cashTransactionsResponse), &DbTransactionsList)
+		converted, _ := connector.ConvertTransactionToYNAB(ynabAccountID, DbTransactionsList.Transactions[0])
+		expected := bank.Details{
+			ID:                    DbTransactionsList.Transactions[0].ID,
+			BookingDate:           "2019-11-04",
+			ValueDate:             "2018-04-23",
+			Amount:                "-19.05",
+			CurrencyCode:          "EUR",
+			CounterPartyName:      "Rossmann",
+			PaymentReference:      "POS MIT PIN. Mein Drogeriemarkt, Leipziger Str.",
+			PaymentIdentification: "212+ZKLE 911/696682-X-ABC",
+			MandateReference:      "MX0355443",
+			CreditorID:            "DE0222200004544221",
+			E2EReference:          "E2E - Reference",
+			TransactionCode:       "123",
+			DomainCode:            "D001",
+			FamilyCode:            "CCRD",
+			SubFamilyCode:         "CWDL",
+		}
+		if converted.Details != expected {
+			t.Errorf("Got wrong bank details. Got %+v want %+v", converted.Details, expected)
+		}
+		if converted.Details.Kind() != bank.KindCard {
+			t.Errorf("Got wrong kind of transaction. Got %s want %s", converted.Details.Kind(), bank.KindCard)
+		}
+	})
+	t.Run("Transactions with an invalid amount are left out", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog(`Leaving out cash transaction bad-amount: amount "1e99999" is out of range`)
+		invalid := DbCashTransactionsList{Transactions: []DbCashTransaction{{ID: "bad-amount", BookingDate: "2019-11-04", Amount: "1e99999"}}}
+		converted := connector.ConvertCashTransactionsToYNAB(invalid, ynabAccountID)
+		testLogBuffer.TestLogValues(t)
+		if len(converted) != 0 {
+			t.Errorf("Transaction with an invalid amount was converted: %+v", converted)
+		}
+	})
+}
+
+func TestCashTransactionsPagination(t *testing.T) {
+	currentToken = &oauth2.Token{
+		AccessToken: "ACCESS_TOKEN",
+		Expiry:      time.Now().AddDate(1, 0, 0),
+	}
+	dbAPIBaseURL = "https://example.com/"
+	defer func() { cashPageSize, maxCashPages = 100, 50 }()
+	cashPageSize = 1
+	from := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2019, 11, 10, 0, 0, 0, 0, time.UTC)
+	mockCashPage := func(offset string, id string) {
+		gock.New(dbAPIBaseURL).
+			Get("/gw/dbapi/banking/transactions/v2/").
+			MatchParam("limit", "1").
+			MatchParam("offset", offset).
+			Reply(200).
+			BodyString(`{"totalItems":3,"limit":1,"offset":` + offset + `,"transactions":[{"amount":-1.5,"bookingDate":"2019-11-05","id":"` + id + `"}]}`)
+	}
+	t.Run("All pages are fetched", func(t *testing.T) {
+		defer gock.Off()
+		mockCashPage("0", "first")
+		mockCashPage("1", "second")
+		mockCashPage("2", "third")
+		logBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		logBuffer.ExpectLog("Fetched 3 cash transactions in 3 pages")
+		transactions, err := connector.getCashTransactions(goodIban, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logBuffer.TestLogValues(t)
+		if len(transactions.Transactions) != 3 || transactions.Transactions[2].ID != "third" {
+			t.Errorf("Got wrong transactions: %+v", transactions.Transactions)
+		}
+	})
+	t.Run("Fetching stops at the page limit", func(t *testing.T) {
+		defer gock.Off()
+		maxCashPages = 2
+		mockCashPage("0", "first")
+		mockCashPage("1", "second")
+		logBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		logBuffer.ExpectLog("Fetched 2 cash transactions in 2 pages, stopped at the page limit. Older transactions in the window were not fetched, sync a shorter window")
+		transactions, _ := connector.getCashTransactions(goodIban, from, to)
+		logBuffer.TestLogValues(t)
+		if len(transactions.Transactions) != 2 {
+			t.Errorf("Got wrong number of transactions. Got %d want %d", len(transactions.Transactions), 2)
+		}
+	})
 }
 
 func runDummyRequest(t *testing.T, verb string, path string, handlerFunc func(w http.ResponseWriter, r *http.Request)) httptest.ResponseRecorder {
@@ -144,3 +238,24 @@ func assertJSONLengthFromRecords(t *testing.T, output string, expectedRecords []
 		t.Errorf("Extra characters counted in output. Expected %d, got %d chars in output %s", expectedOutputLength, outputLength, output)
 	}
 }
+
+func TestCashGetBalance(t *testing.T) {
+	currentToken = &oauth2.Token{
+		AccessToken: "ACCESS_TOKEN",
+		Expiry:      time.Now().AddDate(1, 0, 0),
+	}
+	dbAPIBaseURL = "https://example.com/"
+	defer gock.Off()
+	gock.New(dbAPIBaseURL).
+		Get("/gw/dbapi/banking/cashAccounts/v2/").
+		MatchParam("iban", goodIban).
+		Reply(200).
+		BodyString(`[{"iban":"DE49 5001 0517 8844 2899 51","currencyCode":"EUR","currentBalance":1234.56}]`)
+	balance, err := connector.GetBalance(config.Account{Number: goodIban})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 1234560 {
+		t.Errorf("Got wrong balance. Got %d want 1234560", balance)
+	}
+}
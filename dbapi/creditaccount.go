@@ -1,13 +1,18 @@
 package dbapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
 	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
 	"go.bmvs.io/ynab/api"
 	"go.bmvs.io/ynab/api/transaction"
@@ -16,10 +21,25 @@ import (
 // DbCreditTransaction represents a transaction from a credit card account.
 type DbCreditTransaction struct {
 	BookingDate             string
+	ValueDate               string
+	BillingDate             string
 	ReasonForPayment        string
-	AmountInAccountCurrency struct {
-		Amount float32
-	}
+	AmountInAccountCurrency DbCreditAmount
+	AmountInForeignCurrency DbCreditAmount
+	ForeignFxRate           DbFxRate
+}
+
+// DbCreditAmount is an amount in a currency.
+type DbCreditAmount struct {
+	Amount   json.Number
+	Currency string
+}
+
+// DbFxRate is the exchange rate used for a foreign currency transaction.
+type DbFxRate struct {
+	SourceCurrency string
+	TargetCurrency string
+	Rate           json.Number
 }
 
 // DbCreditTransactionsList is a list of cash transactions as returned by the DB API.
@@ -38,27 +58,37 @@ type DbCreditCardsList struct {
 	Items []DbCreditCard
 }
 
+// DbCreditCardAccount is the account of a credit card, as returned by the DB API.
+type DbCreditCardAccount struct {
+	BalanceAmount DbCreditAmount
+}
+
 // DbCreditConnector is the connector for DB Credit card accounts.
 type DbCreditConnector struct{}
 
-// CheckParams ensures that all parameters are provided.
-func (connector DbCreditConnector) CheckParams() error {
-	return CheckParams()
-}
-
 // IsValidAccountNumber validates that the account number can be processed by this interface.
 func (connector DbCreditConnector) IsValidAccountNumber(accountNumber string) (bool, error) {
 	re := regexp.MustCompile(`^[0-9]{4}$`)
 	return re.MatchString(accountNumber), nil
 }
 
-// GetTransactions gets transactions from DB and returns them in YNAB format.
-func (connector DbCreditConnector) GetTransactions(accountnumber string) ([]ynabTransaction, error) {
-	transactions, err := connector.GetCreditTransactions(accountnumber)
+// GetTransactions gets transactions booked between from and to from DB and
+// returns them in YNAB format.
+// With SyncPending set on the account, pending authorizations are added too.
+func (connector DbCreditConnector) GetTransactions(account config.Account, from time.Time, to time.Time) ([]bank.Transaction, error) {
+	transactions, err := connector.GetCreditTransactions(account.Number, from, to)
+	if err != nil {
+		return nil, err
+	}
+	converted := connector.ConvertCreditTransactionsToYNAB(transactions, account.YNABAccountID)
+	if !account.SyncPending {
+		return converted, nil
+	}
+	pending, err := connector.GetPendingCreditTransactions(account.Number)
 	if err != nil {
-		log.Print(err)
+		return nil, fmt.Errorf("failed getting pending card transactions: %w", err)
 	}
-	return connector.ConvertCreditTransactionsToYNAB(transactions), nil
+	return append(converted, connector.ConvertPendingCreditTransactionsToYNAB(pending, account.YNABAccountID)...), nil
 }
 
 // Authorize checks the current token and returns an authorization URL if necessary.
@@ -71,16 +101,44 @@ func (connector DbCreditConnector) AuthorizedHandler(w http.ResponseWriter, r *h
 	AuthorizedHandler(w, r)
 }
 
-// GetCreditTransactions gets transactions from a credit card.
-func (connector DbCreditConnector) GetCreditTransactions(last4 string) (transactions DbCreditTransactionsList, err error) {
+// GetCreditTransactions gets transactions booked between from and to from a credit card.
+func (connector DbCreditConnector) GetCreditTransactions(last4 string, from time.Time, to time.Time) (transactions DbCreditTransactionsList, err error) {
 	technicalID, err := connector.getTechnicalID(last4)
 	if err != nil {
 		return transactions, err
 	}
 	params := url.Values{}
 	params.Add("technicalId", technicalID)
-	params.Add("bookingDateTo", time.Now().Format("2006-01-02"))
-	params.Add("bookingDateFrom", time.Now().AddDate(0, 0, -10).Format("2006-01-02"))
+	params.Add("bookingDateTo", to.Format("2006-01-02"))
+	params.Add("bookingDateFrom", from.Format("2006-01-02"))
+	err = dbAPIRequest("gw/dbapi/banking/creditCardTransactions/v1?"+params.Encode(), &transactions)
+	return transactions, err
+}
+
+// GetBalance gets the balance of a credit card from DB, in milliunits. Money
+// owed on the card is negative.
+func (connector DbCreditConnector) GetBalance(account config.Account) (int64, error) {
+	technicalID, err := connector.getTechnicalID(account.Number)
+	if err != nil {
+		return 0, err
+	}
+	var cardAccount DbCreditCardAccount
+	if err := dbAPIRequest("gw/dbapi/banking/creditCards/v1/"+url.PathEscape(technicalID)+"/account", &cardAccount); err != nil {
+		return 0, err
+	}
+	return tools.ConvertToMilliunits(cardAccount.BalanceAmount.Amount.String())
+}
+
+// GetPendingCreditTransactions gets the authorizations on a credit card which
+// are not booked yet.
+func (connector DbCreditConnector) GetPendingCreditTransactions(last4 string) (transactions DbCreditTransactionsList, err error) {
+	technicalID, err := connector.getTechnicalID(last4)
+	if err != nil {
+		return transactions, err
+	}
+	params := url.Values{}
+	params.Add("technicalId", technicalID)
+	params.Add("bookingStatus", "PENDING")
 	err = dbAPIRequest("gw/dbapi/banking/creditCardTransactions/v1?"+params.Encode(), &transactions)
 	return transactions, err
 }
@@ -99,41 +157,137 @@ func (connector DbCreditConnector) getTechnicalID(last4 string) (string, error)
 	return "", fmt.Errorf("No credit card found on account with last digits %v", last4)
 }
 
-// ConvertCreditTransactionsToYNAB converts a JSON string of transactions to YNAB format.
-func (connector DbCreditConnector) ConvertCreditTransactionsToYNAB(incomingTransactions DbCreditTransactionsList) []ynabTransaction {
+// ConvertCreditTransactionsToYNAB converts a JSON string of transactions to
+// YNAB format. Transactions which cannot be converted are left out.
+func (connector DbCreditConnector) ConvertCreditTransactionsToYNAB(incomingTransactions DbCreditTransactionsList, ynabAccountID string) []bank.Transaction {
 	transactions := incomingTransactions.Items
-	var convertedTransactions []ynabTransaction
-	var convertedTransaction ynabTransaction
-	resultChannel := make(chan ynabTransaction)
+	importIDs := creditImportIDs(transactions)
+	var convertedTransactions []bank.Transaction
+	resultChannel := make(chan convertedTransaction)
 	defer close(resultChannel)
-	accountNumber := ynabAccountID
-	for _, transaction := range transactions {
-		go func(t DbCreditTransaction) {
-			resultChannel <- connector.convertCreditTransactionToYNAB(accountNumber, t)
-		}(transaction)
+	for i, transaction := range transactions {
+		go func(t DbCreditTransaction, importID string) {
+			converted, err := connector.convertCreditTransactionToYNAB(ynabAccountID, t, importID)
+			resultChannel <- convertedTransaction{converted, err}
+		}(transaction, importIDs[i])
 	}
 	for i := 0; i < len(transactions); i++ {
-		convertedTransaction = <-resultChannel
-		convertedTransactions = append(convertedTransactions, convertedTransaction)
+		result := <-resultChannel
+		if result.err != nil {
+			log.Printf("Leaving out card transaction of %s on %s: %s", result.transaction.Details.Amount, result.transaction.Details.BookingDate, result.err)
+			continue
+		}
+		convertedTransactions = append(convertedTransactions, result.transaction)
 	}
 	return convertedTransactions
 }
 
-func (connector DbCreditConnector) convertCreditTransactionToYNAB(accountNumber string, incomingTransaction DbCreditTransaction) ynabTransaction {
+// ConvertPendingCreditTransactionsToYNAB converts pending card transactions to
+// YNAB format. They are uncleared, dated by their value date as they have no
+// booking date, and their import IDs start with bank.PendingImportIDPrefix, so
+// they can be told apart from booked transactions in YNAB. Authorizations
+// without either date are left out.
+func (connector DbCreditConnector) ConvertPendingCreditTransactionsToYNAB(incomingTransactions DbCreditTransactionsList, ynabAccountID string) []bank.Transaction {
+	var dated DbCreditTransactionsList
+	for _, item := range incomingTransactions.Items {
+		if item.BookingDate == "" {
+			item.BookingDate = item.ValueDate
+		}
+		if item.BookingDate == "" {
+			log.Printf("Leaving out pending card transaction of %s at %s, it has no date", item.AmountInAccountCurrency.Amount, item.ReasonForPayment)
+			continue
+		}
+		dated.Items = append(dated.Items, item)
+	}
+	transactions := connector.ConvertCreditTransactionsToYNAB(dated, ynabAccountID)
+	for i := range transactions {
+		importID := bank.PendingImportIDPrefix + (*transactions[i].ImportID)[:36-len(bank.PendingImportIDPrefix)]
+		transactions[i].ImportID = &importID
+		transactions[i].LegacyImportID = ""
+		transactions[i].Cleared = transaction.ClearingStatusUncleared
+		transactions[i].Details.Pending = true
+	}
+	return transactions
+}
+
+// convertCreditTransactionToYNAB converts a card transaction to YNAB format. It
+// returns an error if the date or amount cannot be read.
+func (connector DbCreditConnector) convertCreditTransactionToYNAB(accountNumber string, incomingTransaction DbCreditTransaction, importID string) (bank.Transaction, error) {
+	details := bank.Details{
+		BookingDate:      incomingTransaction.BookingDate,
+		ValueDate:        incomingTransaction.ValueDate,
+		BillingDate:      incomingTransaction.BillingDate,
+		Amount:           incomingTransaction.AmountInAccountCurrency.Amount.String(),
+		CurrencyCode:     incomingTransaction.AmountInAccountCurrency.Currency,
+		PaymentReference: incomingTransaction.ReasonForPayment,
+		FamilyCode:       "CCRD",
+		ForeignAmount:    incomingTransaction.AmountInForeignCurrency.Amount.String(),
+		ForeignCurrency:  incomingTransaction.AmountInForeignCurrency.Currency,
+		FxRate:           incomingTransaction.ForeignFxRate.Rate.String(),
+	}
 	date, err := api.DateFromString(incomingTransaction.BookingDate)
 	if err != nil {
-		log.Fatal(err)
+		return bank.Transaction{Details: details}, err
+	}
+	amount, err := tools.ConvertToMilliunits(details.Amount)
+	if err != nil {
+		return bank.Transaction{Details: details}, err
 	}
-	importIDSource := incomingTransaction.BookingDate + fmt.Sprintf("%f", incomingTransaction.AmountInAccountCurrency.Amount)
-	importID := tools.CreateImportID(importIDSource)
 	transaction := ynabTransaction{
 		AccountID: accountNumber,
 		Date:      date,
-		Amount:    tools.ConvertToMilliunits(incomingTransaction.AmountInAccountCurrency.Amount),
+		Amount:    amount,
 		PayeeName: &incomingTransaction.ReasonForPayment,
 		Cleared:   transaction.ClearingStatusCleared,
 		Approved:  false,
 		ImportID:  &importID,
 	}
-	return transaction
+	return bank.Transaction{
+		PayloadTransaction: transaction,
+		LegacyImportID:     legacyCreditImportID(incomingTransaction),
+		Details:            details,
+	}, nil
+}
+
+// creditImportIDs returns an import ID for each transaction. The card API has
+// no transaction IDs, so transactions are identified by their booking date,
+// amount, reason for payment and value date. Transactions which are the same in
+// all of these get an occurrence index. Each ID depends only on the
+// transaction's own fields, so it stays the same when other transactions with
+// the same date and amount are booked later.
+func creditImportIDs(transactions []DbCreditTransaction) []string {
+	occurrences := make(map[string]int)
+	importIDs := make([]string, len(transactions))
+	for i, transaction := range transactions {
+		source := creditImportIDSource(transaction)
+		if occurrence := occurrences[source]; occurrence > 0 {
+			importIDs[i] = tools.CreateImportID(fmt.Sprintf("%s#%d", source, occurrence))
+		} else {
+			importIDs[i] = tools.CreateImportID(source)
+		}
+		occurrences[source]++
+	}
+	return importIDs
+}
+
+// creditImportIDSource is the source of a transaction's import ID.
+func creditImportIDSource(transaction DbCreditTransaction) string {
+	return strings.Join([]string{
+		legacyCreditImportIDSource(transaction),
+		transaction.ReasonForPayment,
+		transaction.ValueDate,
+	}, "\x00")
+}
+
+// legacyCreditImportID is the import ID earlier versions gave a transaction,
+// from only its booking date and amount.
+func legacyCreditImportID(transaction DbCreditTransaction) string {
+	return tools.CreateImportID(legacyCreditImportIDSource(transaction))
+}
+
+// legacyCreditImportIDSource formats the amount as a float32, like earlier
+// versions did.
+func legacyCreditImportIDSource(transaction DbCreditTransaction) string {
+	amount, _ := strconv.ParseFloat(transaction.AmountInAccountCurrency.Amount.String(), 32)
+	return transaction.BookingDate + fmt.Sprintf("%f", float32(amount))
 }
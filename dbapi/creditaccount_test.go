@@ -3,9 +3,13 @@ package dbapi
 import (
 	"encoding/json"
 	"log"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
 	"golang.org/x/oauth2"
 	"gopkg.in/h2non/gock.v1"
 )
@@ -62,15 +66,17 @@ func testSuccessfulGetCreditTransactions(t *testing.T) {
 	gock.New(dbAPIBaseURL).
 		Get("gw/dbapi/banking/creditCardTransactions/v1").
 		MatchParam("technicalId", technicalID).
-		MatchParam("bookingDateTo", time.Now().Format("2006-01-02")).
-		MatchParam("bookingDateFrom", time.Now().AddDate(0, 0, -10).Format("2006-01-02")).
+		MatchParam("bookingDateTo", "2017-09-30").
+		MatchParam("bookingDateFrom", "2017-09-01").
 		MatchHeader("Authorization", "^Bearer (.*)$").
 		Reply(200).
 		BodyString(cardTransactionResponse)
-	result, _ := connector.GetCreditTransactions(last4)
+	from := time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2017, 9, 30, 0, 0, 0, 0, time.UTC)
+	result, _ := connector.GetCreditTransactions(last4, from, to)
 	marshalledResult, _ := json.Marshal(result)
 	stringResult := string(marshalledResult[:])
-	expected := `{"Items":[{"BookingDate":"2017-09-02","ReasonForPayment":"Marvel Comics Inc.","AmountInAccountCurrency":{"Amount":42.21}}]}`
+	expected := `{"Items":[{"BookingDate":"2017-09-02","ValueDate":"2017-09-02","BillingDate":"2017-09-28","ReasonForPayment":"Marvel Comics Inc.","AmountInAccountCurrency":{"Amount":42.21,"Currency":"EUR"},"AmountInForeignCurrency":{"Amount":42.21,"Currency":"EUR"},"ForeignFxRate":{"SourceCurrency":"EUR","TargetCurrency":"EUR","Rate":1}}]}`
 	if stringResult != expected {
 		t.Errorf("Got wrong value: got %s want %s",
 			stringResult, expected)
@@ -92,28 +98,121 @@ func testFailingGetCreditTransactions(t *testing.T) {
 		Reply(200).
 		BodyString(cardListResponse)
 
-	_, err := connector.GetCreditTransactions(last4)
+	_, err := connector.GetCreditTransactions(last4, time.Now().AddDate(0, 0, -10), time.Now())
 	if err == nil {
 		t.Error("Did not error out on invalid credit card number")
 	}
+	gock.New(dbAPIBaseURL).
+		Get("gw/dbapi/banking/creditCards/v1/").
+		MatchHeader("Authorization", "^Bearer (.*)$").
+		Reply(200).
+		BodyString(cardListResponse)
+	transactions, err := connector.GetTransactions(config.Account{Number: last4, YNABAccountID: "account-id"}, time.Now().AddDate(0, 0, -10), time.Now())
+	if err == nil || transactions != nil {
+		t.Errorf("Did not return the error of a failed card fetch. Got %v, %v", transactions, err)
+	}
 }
 
 func TestConvertCreditTransactionsToYNAB(t *testing.T) {
 	t.Run("Test converting credit transactions to ynab format", func(t *testing.T) {
 		connector := DbCreditConnector{}
-		ynabAccountID = "account-id"
+		ynabAccountID := "account-id"
 		input := []byte(cardTransactionResponse)
 		var DbTransactionsList DbCreditTransactionsList
 		json.Unmarshal(input, &DbTransactionsList)
-		converted := connector.ConvertCreditTransactionsToYNAB(DbTransactionsList)
-		marshalledOutput, err := json.Marshal((converted))
+		converted := connector.ConvertCreditTransactionsToYNAB(DbTransactionsList, ynabAccountID)
+		marshalledOutput, err := json.Marshal(bank.Payloads(converted))
 		output := string(marshalledOutput)
 		if err != nil {
 			log.Fatal(err)
 		}
-		expected := string(`[{"account_id":"account-id","date":"2017-09-02","amount":42210,"cleared":"cleared","approved":false,"payee_id":null,"payee_name":"Marvel Comics Inc.","category_id":null,"memo":null,"flag_color":null,"import_id":"5881cb1c0abd80695891732f39924704"}]`)
+		expected := string(`[{"account_id":"account-id","date":"2017-09-02","amount":42210,"cleared":"cleared","approved":false,"payee_id":null,"payee_name":"Marvel Comics Inc.","category_id":null,"memo":null,"flag_color":null,"import_id":"52ba628b407891eb8a965815c3a82eba"}]`)
 		if output != expected {
 			t.Errorf("Got wrong value: got %s wanted %s", output, expected)
 		}
+		if converted[0].LegacyImportID != "5881cb1c0abd80695891732f39924704" {
+			t.Errorf("Got wrong legacy import ID: got %s wanted 5881cb1c0abd80695891732f39924704", converted[0].LegacyImportID)
+		}
+	})
+}
+
+func TestConvertCreditTransactionsWithInvalidAmount(t *testing.T) {
+	testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+	testLogBuffer.ExpectLog(`Leaving out card transaction of 12,50 on 2017-09-02: invalid amount "12,50"`)
+	invalid := DbCreditTransactionsList{Items: []DbCreditTransaction{
+		{BookingDate: "2017-09-02", ReasonForPayment: "Marvel Comics Inc.", AmountInAccountCurrency: DbCreditAmount{Amount: "12,50", Currency: "EUR"}},
+	}}
+	converted := DbCreditConnector{}.ConvertCreditTransactionsToYNAB(invalid, "account-id")
+	testLogBuffer.TestLogValues(t)
+	if len(converted) != 0 {
+		t.Errorf("Transaction with an invalid amount was converted: %+v", converted)
+	}
+}
+
+func TestConvertPendingCreditTransactionsToYNAB(t *testing.T) {
+	connector := DbCreditConnector{}
+	pending := DbCreditTransactionsList{Items: []DbCreditTransaction{
+		{ValueDate: "2017-09-29", ReasonForPayment: "Marvel Comics Inc.", AmountInAccountCurrency: DbCreditAmount{Amount: "-42.21", Currency: "EUR"}},
+	}}
+	converted := connector.ConvertPendingCreditTransactionsToYNAB(pending, "account-id")
+	if len(converted) != 1 {
+		t.Fatalf("Got wrong number of transactions. Got %d want 1", len(converted))
+	}
+	transaction := converted[0]
+	if transaction.Cleared != "uncleared" || !transaction.Details.Pending {
+		t.Errorf("Pending transaction is not uncleared: %+v", transaction)
+	}
+	if transaction.Date.Format("2006-01-02") != "2017-09-29" {
+		t.Errorf("Got wrong date. Got %s want 2017-09-29", transaction.Date.Format("2006-01-02"))
+	}
+	if importID := *transaction.ImportID; len(importID) != 36 || !strings.HasPrefix(importID, bank.PendingImportIDPrefix) {
+		t.Errorf("Got wrong import ID for a pending transaction: %s", importID)
+	}
+	t.Run("Pending transactions without a date are left out", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Leaving out pending card transaction of -9.99 at Hotel, it has no date")
+		undated := DbCreditTransactionsList{Items: []DbCreditTransaction{
+			{ReasonForPayment: "Hotel", AmountInAccountCurrency: DbCreditAmount{Amount: "-9.99", Currency: "EUR"}},
+		}}
+		converted := connector.ConvertPendingCreditTransactionsToYNAB(undated, "account-id")
+		testLogBuffer.TestLogValues(t)
+		if len(converted) != 0 {
+			t.Errorf("Pending transaction without a date was converted: %+v", converted)
+		}
+	})
+}
+
+func TestCreditImportIDs(t *testing.T) {
+	coffee := DbCreditTransaction{BookingDate: "2017-09-02", ReasonForPayment: "Coffee Shop", AmountInAccountCurrency: DbCreditAmount{Amount: "-3.5"}}
+	bakery := DbCreditTransaction{BookingDate: "2017-09-02", ReasonForPayment: "Bakery", AmountInAccountCurrency: DbCreditAmount{Amount: "-3.5"}}
+	t.Run("Same-day transactions with the same amount get different IDs", func(t *testing.T) {
+		importIDs := creditImportIDs([]DbCreditTransaction{coffee, coffee})
+		if importIDs[0] == importIDs[1] {
+			t.Errorf("Identical transactions got the same import ID %s", importIDs[0])
+		}
+	})
+	t.Run("Import IDs do not change when the group grows", func(t *testing.T) {
+		before := creditImportIDs([]DbCreditTransaction{coffee})
+		after := creditImportIDs([]DbCreditTransaction{bakery, coffee})
+		if after[1] != before[0] {
+			t.Errorf("Import ID changed when another transaction was booked. Got %s want %s", after[1], before[0])
+		}
+		if after[0] == after[1] {
+			t.Errorf("Transactions with different payees got the same import ID %s", after[0])
+		}
+	})
+	t.Run("Converted transactions keep the earlier import ID as legacy", func(t *testing.T) {
+		legacyID := tools.CreateImportID("2017-09-02-3.500000")
+		converted := DbCreditConnector{}.ConvertCreditTransactionsToYNAB(DbCreditTransactionsList{Items: []DbCreditTransaction{coffee}}, "account-id")
+		if converted[0].LegacyImportID != legacyID {
+			t.Errorf("Got wrong legacy import ID. Got %s want %s", converted[0].LegacyImportID, legacyID)
+		}
+	})
+	t.Run("Import IDs do not depend on the order of transactions", func(t *testing.T) {
+		forward := creditImportIDs([]DbCreditTransaction{coffee, bakery})
+		backward := creditImportIDs([]DbCreditTransaction{bakery, coffee})
+		if forward[0] != backward[1] || forward[1] != backward[0] {
+			t.Errorf("Import IDs changed with the order of transactions. Got %v and %v", forward, backward)
+		}
 	})
 }
@@ -7,29 +7,48 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
+	"time"
 
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
 	"golang.org/x/oauth2"
 )
 
 var (
-	accountNumber  string = os.Getenv("DB_ACCOUNT")
-	dbClientID     string = os.Getenv("DB_CLIENT_ID")
-	dbClientSecret string = os.Getenv("DB_CLIENT_SECRET")
-	dbAPIBaseURL   string = os.Getenv("DB_API_ENDPOINT_HOSTNAME")
-	redirectURL    string = os.Getenv("REDIRECT_BASE_URL") + "authorized"
-	currentToken          = &oauth2.Token{}
+	dbClientID     string
+	dbClientSecret string
+	dbAPIBaseURL   string
+	redirectURL    string
+	tokenFile      string
+	currentToken   = &oauth2.Token{}
 )
 
-var oauth2Conf = &oauth2.Config{
-	ClientID:     dbClientID,
-	ClientSecret: dbClientSecret,
-	RedirectURL:  redirectURL,
-	Scopes:       []string{"read_transactions", "read_accounts", "read_credit_cards_list_with_details", "read_credit_card_transactions", "offline_access"},
-	Endpoint: oauth2.Endpoint{
-		AuthURL:  dbAPIBaseURL + "gw/oidc/authorize",
-		TokenURL: dbAPIBaseURL + "gw/oidc/token",
-	},
+var oauth2Conf = newOauth2Config()
+
+// Configure sets the DB API parameters from the configuration.
+func Configure(settings config.DB) {
+	dbClientID = settings.ClientID
+	dbClientSecret = settings.ClientSecret
+	dbAPIBaseURL = settings.APIBaseURL
+	redirectURL = settings.RedirectBaseURL + "authorized"
+	tokenFile = settings.TokenFile
+	tokenKey = settings.TokenKey
+	tokenKeyFile = settings.TokenKeyFile
+	oldTokenKey = settings.PreviousTokenKey
+	oldTokenKeyFile = settings.PreviousTokenKeyFile
+	oauth2Conf = newOauth2Config()
+}
+
+func newOauth2Config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     dbClientID,
+		ClientSecret: dbClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"read_transactions", "read_accounts", "read_credit_cards_list_with_details", "read_credit_card_transactions", "offline_access"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  dbAPIBaseURL + "gw/oidc/authorize",
+			TokenURL: dbAPIBaseURL + "gw/oidc/token",
+		},
+	}
 }
 
 var oauth2HttpContext context.Context = context.Background()
@@ -37,27 +56,20 @@ var oauth2HttpContext context.Context = context.Background()
 // Authorize checks the current token and returns an authorization URL if necessary.
 func Authorize() string {
 	if currentToken.RefreshToken == "" {
-		url := oauth2Conf.AuthCodeURL("state", oauth2.AccessTypeOffline)
-		return url
+		return AuthorizationURL()
 	}
 	return ""
 }
 
-// CheckParams ensures that all parameters are provided and fails hard if not.
-func CheckParams() error {
-	var params = map[string]string{
-		"accountNumber":  accountNumber,
-		"dbClientID":     dbClientID,
-		"dbClientSecret": dbClientSecret,
-		"dbAPIBaseURL":   dbAPIBaseURL,
-		"redirectURL":    redirectURL,
-	}
-	for i, v := range params {
-		if v == "" {
-			return fmt.Errorf("missing/empty connector parameter detected. Cannot proceed without a value for %v", i)
-		}
-	}
-	return nil
+// AuthorizationURL returns the URL to log in to DB, whether or not we already have a token.
+func AuthorizationURL() string {
+	return oauth2Conf.AuthCodeURL("state", oauth2.AccessTypeOffline)
+}
+
+// TokenExpiry returns when the current access token expires. It is refreshed
+// automatically, as long as the refresh token is still valid.
+func TokenExpiry() time.Time {
+	return currentToken.Expiry
 }
 
 // AuthorizedHandler handles the oauth HTTP response.
@@ -78,7 +90,8 @@ func AuthorizedHandler(w http.ResponseWriter, r *http.Request) {
 
 // dbAPIRequest makes a call to the DB API and loads the JSON response into a slice.
 func dbAPIRequest(path string, recipient interface{}) error {
-	request, err := oauth2Conf.Client(oauth2HttpContext, currentToken).Get(dbAPIBaseURL + path)
+	tokenSource := savingTokenSource{oauth2Conf.TokenSource(oauth2HttpContext, currentToken)}
+	request, err := oauth2.NewClient(oauth2HttpContext, tokenSource).Get(dbAPIBaseURL + path)
 	if err != nil {
 		return err
 	}
@@ -98,11 +111,62 @@ func UpdateToken(code string) error {
 	if err != nil {
 		return err
 	}
-	SetCurrentToken(tok)
-	return nil
+	return SetCurrentToken(tok)
 }
 
-// SetCurrentToken sets the currently active token. Mostly useful for tests.
-func SetCurrentToken(token *oauth2.Token) {
+// SetCurrentToken sets the currently active token and saves it to the token store.
+func SetCurrentToken(token *oauth2.Token) error {
 	currentToken = token
+	return tokenStore.Save(token)
+}
+
+// SetTokenStore sets the token store and loads any token already saved in it.
+func SetTokenStore(store TokenStore) error {
+	tokenStore = store
+	token, err := store.Load()
+	if err != nil {
+		return err
+	}
+	if token != nil {
+		currentToken = token
+	}
+	return nil
+}
+
+// LoadTokenStore sets up the configured token store. Without a token file,
+// tokens are kept in memory only. With a token key, the token file is encrypted.
+func LoadTokenStore() error {
+	if tokenFile == "" {
+		log.Print("No DB token file is set, the DB token will not survive a restart")
+		return SetTokenStore(&MemoryTokenStore{})
+	}
+	tokenCipher, err := loadTokenCipher()
+	if err != nil {
+		return err
+	}
+	if tokenCipher == nil {
+		log.Print("No DB token key is set, the DB token will be saved unencrypted")
+	}
+	store := NewFileTokenStore(tokenFile)
+	store.Cipher = tokenCipher
+	return SetTokenStore(store)
+}
+
+// loadTokenCipher returns the configured token cipher, or nil if no token key is set.
+func loadTokenCipher() (*TokenCipher, error) {
+	key, err := readTokenKey(tokenKey, tokenKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	oldKey, err := readTokenKey(oldTokenKey, oldTokenKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		if len(oldKey) > 0 {
+			return nil, fmt.Errorf("a previous DB token key is set without a current one")
+		}
+		return nil, nil
+	}
+	return NewTokenCipher(key, oldKey)
 }
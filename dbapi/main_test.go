@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"testing"
 
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
 	"golang.org/x/oauth2"
 	"gopkg.in/h2non/gock.v1"
 )
@@ -43,6 +44,16 @@ func TestAuthorize(t *testing.T) {
 			}
 		}
 	})
+	t.Run("Authorize returns nothing with a refresh token.", func(t *testing.T) {
+		currentToken.RefreshToken = "REFRESH_TOKEN"
+		defer func() { currentToken.RefreshToken = "" }()
+		if got := Authorize(); got != "" {
+			t.Errorf("Returned an authorization URL with a refresh token: %s", got)
+		}
+		if AuthorizationURL() == "" {
+			t.Error("AuthorizationURL did not return a URL with a refresh token.")
+		}
+	})
 }
 
 func TestAuthorizedHandler(t *testing.T) {
@@ -69,24 +80,31 @@ func TestAuthorizedHandler(t *testing.T) {
 	})
 }
 
-func TestCheckParams(t *testing.T) {
-	t.Run("Panic when missing a parameter", func(t *testing.T) {
-		var values [5]string
-		// Try checking params with each possible param empty.
-		for i := range values {
-			values[i] = "dummy_value"
-		}
-		for i := range values {
-			valuesWithOneEmpty := values
-			valuesWithOneEmpty[i] = ""
-			setParams(valuesWithOneEmpty)
-			err := CheckParams()
-			if err == nil {
-				t.Errorf("Missing parameter did not return an error")
-			}
-		}
-
+func TestConfigure(t *testing.T) {
+	defer setTestOauth2Config()
+	Configure(config.DB{
+		ClientID:        dummyClientID,
+		ClientSecret:    "client-secret",
+		APIBaseURL:      "https://api.example.com/",
+		RedirectBaseURL: "https://sync.example.com/",
+		TokenFile:       "/data/token.json",
 	})
+	expect := []struct {
+		got  string
+		want string
+	}{
+		{oauth2Conf.ClientID, dummyClientID},
+		{oauth2Conf.ClientSecret, "client-secret"},
+		{oauth2Conf.RedirectURL, "https://sync.example.com/authorized"},
+		{oauth2Conf.Endpoint.AuthURL, "https://api.example.com/gw/oidc/authorize"},
+		{oauth2Conf.Endpoint.TokenURL, "https://api.example.com/gw/oidc/token"},
+		{tokenFile, "/data/token.json"},
+	}
+	for _, value := range expect {
+		if value.got != value.want {
+			t.Errorf("Configured wrong value. Got %s want %s", value.got, value.want)
+		}
+	}
 }
 
 func TestSetCurrentToken(t *testing.T) {
@@ -97,27 +115,25 @@ func TestSetCurrentToken(t *testing.T) {
 			t.Errorf("Failed retrieving set token. Got %s expected %s", currentToken.AccessToken, tokenValue)
 		}
 	})
-}
-
-func setParams(values [5]string) {
-	accountNumber = values[0]
-	dbClientID = values[1]
-	dbClientSecret = values[2]
-	dbAPIBaseURL = values[3]
-	redirectURL = values[4]
+	t.Run("Setting a token saves it to the token store", func(t *testing.T) {
+		defer SetTokenStore(&MemoryTokenStore{})
+		store := &MemoryTokenStore{}
+		SetTokenStore(store)
+		tokenValue := "testing-stored-token"
+		SetCurrentToken(&oauth2.Token{AccessToken: tokenValue})
+		saved, _ := store.Load()
+		if saved == nil || saved.AccessToken != tokenValue {
+			t.Errorf("Token was not saved to the token store. Got %v expected %s", saved, tokenValue)
+		}
+	})
 }
 
 func setTestOauth2Config() {
-	dbAPIBaseURL = "https://example.com/"
-	oauth2Conf = &oauth2.Config{
+	Configure(config.DB{
 		ClientID:     dbClientID,
 		ClientSecret: dbClientSecret,
-		Scopes:       []string{"read_transactions", "read_accounts", "read_credit_cards_list_with_details", "read_credit_card_transactions", "offline_access"},
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  dbAPIBaseURL + "gw/oidc/authorize",
-			TokenURL: dbAPIBaseURL + "gw/oidc/token",
-		},
-	}
+		APIBaseURL:   "https://example.com/",
+	})
 }
 
 // AssertStatus is a test convenience function to compare HTTP status codes.
@@ -0,0 +1,156 @@
+package dbapi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Token encryption keys. The previous key is only used to open tokens saved
+// before a key rotation.
+var (
+	tokenKey        string
+	tokenKeyFile    string
+	oldTokenKey     string
+	oldTokenKeyFile string
+)
+
+// ErrWrongTokenKey is returned when none of the configured keys can decrypt the saved token.
+var ErrWrongTokenKey = errors.New("cannot decrypt the saved DB token with the configured key. Set the key it was saved with (as DB_TOKEN_PREVIOUS_KEY when rotating keys), or delete the token file to authorize again")
+
+// errTokenNotEncrypted is returned when opening a token that was saved without encryption.
+var errTokenNotEncrypted = errors.New("saved DB token is not encrypted")
+
+const sealedTokenVersion = 1
+
+// Parameters for deriving the AES-256 key from a passphrase or key file.
+const (
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLength   = 16
+)
+
+// sealedToken is the on-disk format of an encrypted token.
+type sealedToken struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// TokenCipher seals tokens with AES-GCM, using a key derived from a secret.
+// Tokens are always sealed with the current secret. Previous secrets are only
+// used to open tokens saved before a key rotation.
+type TokenCipher struct {
+	secrets [][]byte
+}
+
+// NewTokenCipher returns a TokenCipher sealing with current, which can also open
+// tokens sealed with any of the previous secrets.
+func NewTokenCipher(current []byte, previous ...[]byte) (*TokenCipher, error) {
+	if len(current) == 0 {
+		return nil, errors.New("token encryption key is empty")
+	}
+	secrets := [][]byte{current}
+	for _, secret := range previous {
+		if len(secret) > 0 {
+			secrets = append(secrets, secret)
+		}
+	}
+	return &TokenCipher{secrets: secrets}, nil
+}
+
+// Seal encrypts plaintext with the current secret.
+func (c *TokenCipher) Seal(plaintext []byte) ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(c.secrets[0], salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealedToken{
+		Version:    sealedTokenVersion,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	})
+}
+
+// Open decrypts a sealed token. It reports whether the token was sealed with a
+// previous secret, in which case it should be sealed again with the current one.
+func (c *TokenCipher) Open(sealed []byte) (plaintext []byte, rotated bool, err error) {
+	var envelope sealedToken
+	if err := json.Unmarshal(sealed, &envelope); err != nil {
+		return nil, false, err
+	}
+	if envelope.Version == 0 {
+		return nil, false, errTokenNotEncrypted
+	}
+	if envelope.Version != sealedTokenVersion {
+		return nil, false, fmt.Errorf("saved DB token has unsupported encryption version %d", envelope.Version)
+	}
+	for i, secret := range c.secrets {
+		aead, err := newAEAD(secret, envelope.Salt)
+		if err != nil {
+			return nil, false, err
+		}
+		plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, nil)
+		if err == nil {
+			return plaintext, i > 0, nil
+		}
+	}
+	return nil, false, ErrWrongTokenKey
+}
+
+func newAEAD(secret []byte, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(secret, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isSealedToken checks if stored token contents are encrypted.
+func isSealedToken(contents []byte) bool {
+	var envelope sealedToken
+	return json.Unmarshal(contents, &envelope) == nil && envelope.Version != 0
+}
+
+// readTokenKey returns the key from a passphrase or the contents of a key file.
+func readTokenKey(passphrase string, keyFile string) ([]byte, error) {
+	if passphrase != "" && keyFile != "" {
+		return nil, errors.New("token key passphrase and key file are both set, use only one of them")
+	}
+	if keyFile == "" {
+		return []byte(passphrase), nil
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read token key file: %w", err)
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("token key file %s is empty", keyFile)
+	}
+	return key, nil
+}
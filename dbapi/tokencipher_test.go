@@ -0,0 +1,114 @@
+package dbapi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenCipher(t *testing.T) {
+	plaintext := []byte(`{"access_token":"ACCESS_TOKEN","refresh_token":"REFRESH_TOKEN"}`)
+	tokenCipher, _ := NewTokenCipher([]byte("correct horse battery staple"))
+	sealed, err := tokenCipher.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Sealed token does not contain the plaintext", func(t *testing.T) {
+		if bytes.Contains(sealed, []byte("REFRESH_TOKEN")) {
+			t.Errorf("Sealed token contains the plaintext refresh token: %s", sealed)
+		}
+	})
+	t.Run("Open a sealed token with the same key", func(t *testing.T) {
+		got, rotated, err := tokenCipher.Open(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("Opened token does not match. Got %s want %s", got, plaintext)
+		}
+		if rotated {
+			t.Error("Token sealed with the current key was reported as rotated")
+		}
+	})
+	t.Run("Opening with the wrong key fails clearly", func(t *testing.T) {
+		wrongCipher, _ := NewTokenCipher([]byte("Tr0ub4dor&3"))
+		_, _, err := wrongCipher.Open(sealed)
+		if err != ErrWrongTokenKey {
+			t.Errorf("Got wrong error opening with the wrong key. Got %v want %v", err, ErrWrongTokenKey)
+		}
+	})
+	t.Run("Open a token sealed with the previous key", func(t *testing.T) {
+		rotatedCipher, _ := NewTokenCipher([]byte("new key"), []byte("correct horse battery staple"))
+		got, rotated, err := rotatedCipher.Open(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("Opened token does not match. Got %s want %s", got, plaintext)
+		}
+		if !rotated {
+			t.Error("Token sealed with the previous key was not reported as rotated")
+		}
+	})
+	t.Run("An empty key is refused", func(t *testing.T) {
+		if _, err := NewTokenCipher(nil); err == nil {
+			t.Error("Empty key did not return an error")
+		}
+	})
+}
+
+func TestEncryptedFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbapi-tokencipher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token.json")
+	oldCipher, _ := NewTokenCipher([]byte("old key"))
+	newCipher, _ := NewTokenCipher([]byte("new key"), []byte("old key"))
+	token := &oauth2.Token{AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"}
+
+	t.Run("Unencrypted tokens are encrypted on load", func(t *testing.T) {
+		NewFileTokenStore(path).Save(token)
+		store := &FileTokenStore{Path: path, Cipher: oldCipher}
+		assertLoadsToken(t, store, token)
+		assertFileIsEncrypted(t, path)
+	})
+	t.Run("Encrypted tokens cannot be loaded without a key", func(t *testing.T) {
+		if _, err := NewFileTokenStore(path).Load(); err == nil {
+			t.Error("Loading an encrypted token without a key did not return an error")
+		}
+	})
+	t.Run("Rotated keys re-encrypt the token", func(t *testing.T) {
+		store := &FileTokenStore{Path: path, Cipher: newCipher}
+		assertLoadsToken(t, store, token)
+		_, err := (&FileTokenStore{Path: path, Cipher: oldCipher}).Load()
+		if err != ErrWrongTokenKey {
+			t.Errorf("Token was not re-encrypted with the new key. Got %v want %v", err, ErrWrongTokenKey)
+		}
+	})
+}
+
+func assertLoadsToken(t *testing.T, store TokenStore, expect *oauth2.Token) {
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.AccessToken != expect.AccessToken || got.RefreshToken != expect.RefreshToken {
+		t.Errorf("Loaded wrong token. Got %v want %v", got, expect)
+	}
+}
+
+func assertFileIsEncrypted(t *testing.T, path string) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealedToken(contents) {
+		t.Errorf("Token file is not encrypted: %s", contents)
+	}
+}
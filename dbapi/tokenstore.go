@@ -0,0 +1,157 @@
+package dbapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenStore is where the current token is saved and loaded from.
+var tokenStore TokenStore = &MemoryTokenStore{}
+
+// TokenStore persists the OAuth token between runs.
+type TokenStore interface {
+	// Load returns the stored token, or nil if there is none yet.
+	Load() (*oauth2.Token, error)
+	// Save replaces the stored token.
+	Save(*oauth2.Token) error
+}
+
+// FileTokenStore keeps the token as JSON in a file on disk. If a Cipher is set,
+// the token is encrypted.
+type FileTokenStore struct {
+	Path   string
+	Cipher *TokenCipher
+}
+
+// NewFileTokenStore returns a TokenStore backed by the file at path.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+// Load reads the token from disk. A missing file is not an error.
+func (s *FileTokenStore) Load() (*oauth2.Token, error) {
+	contents, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resave := false
+	if s.Cipher != nil {
+		var rotated bool
+		contents, rotated, err = s.openToken(contents)
+		if err != nil {
+			return nil, err
+		}
+		resave = rotated
+	} else if isSealedToken(contents) {
+		return nil, fmt.Errorf("DB token file %s is encrypted, but no token key is set", s.Path)
+	}
+	token := &oauth2.Token{}
+	if err := json.Unmarshal(contents, token); err != nil {
+		return nil, err
+	}
+	if resave {
+		log.Print("Re-encrypting saved DB token with the current key")
+		if err := s.Save(token); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// openToken decrypts the file contents. Unencrypted tokens from before a key
+// was set are accepted, and reported as needing to be saved again.
+func (s *FileTokenStore) openToken(contents []byte) ([]byte, bool, error) {
+	plaintext, rotated, err := s.Cipher.Open(contents)
+	if err == errTokenNotEncrypted {
+		return contents, true, nil
+	}
+	return plaintext, rotated, err
+}
+
+// Save writes the token to disk, readable only by the current user.
+func (s *FileTokenStore) Save(token *oauth2.Token) error {
+	contents, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if s.Cipher != nil {
+		contents, err = s.Cipher.Seal(contents)
+		if err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(s.Path, contents)
+}
+
+// writeFileAtomic writes to a temporary file and renames it into place, so a
+// crash never leaves a half-written file behind.
+func writeFileAtomic(path string, contents []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// MemoryTokenStore keeps the token in memory only. Mostly useful for tests.
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// Load returns the token held in memory.
+func (s *MemoryTokenStore) Load() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token, nil
+}
+
+// Save holds the token in memory.
+func (s *MemoryTokenStore) Save(token *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+	return nil
+}
+
+// savingTokenSource saves tokens to the token store whenever the oauth2
+// client refreshes them.
+type savingTokenSource struct {
+	source oauth2.TokenSource
+}
+
+func (s savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken != currentToken.AccessToken {
+		log.Print("DB token was refreshed, saving it")
+		if err := SetCurrentToken(token); err != nil {
+			log.Printf("Failed to save refreshed DB token: %s", err)
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,98 @@
+package dbapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbapi-tokenstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileTokenStore(filepath.Join(dir, "token.json"))
+	t.Run("Loading a missing file returns no token", func(t *testing.T) {
+		token, err := store.Load()
+		if err != nil {
+			t.Errorf("Unexpected error loading missing token file: %s", err)
+		}
+		if token != nil {
+			t.Errorf("Got a token from a missing file: %v", token)
+		}
+	})
+	t.Run("Save a token and load it again", func(t *testing.T) {
+		expiry := time.Now().Add(time.Hour).Round(time.Second)
+		err := store.Save(&oauth2.Token{AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN", Expiry: expiry})
+		if err != nil {
+			t.Fatalf("Failed saving token: %s", err)
+		}
+		token, err := store.Load()
+		if err != nil {
+			t.Fatalf("Failed loading token: %s", err)
+		}
+		if token.AccessToken != "ACCESS_TOKEN" || token.RefreshToken != "REFRESH_TOKEN" || !token.Expiry.Equal(expiry) {
+			t.Errorf("Loaded token does not match saved token: %v", token)
+		}
+	})
+	t.Run("Token file is only readable by the owner", func(t *testing.T) {
+		info, err := os.Stat(store.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Token file has wrong permissions. Got %v want %v", info.Mode().Perm(), os.FileMode(0600))
+		}
+	})
+}
+
+func TestSetTokenStore(t *testing.T) {
+	defer SetTokenStore(&MemoryTokenStore{})
+	store := &MemoryTokenStore{}
+	store.Save(&oauth2.Token{AccessToken: "STORED_TOKEN"})
+	if err := SetTokenStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if currentToken.AccessToken != "STORED_TOKEN" {
+		t.Errorf("Stored token was not loaded. Got %s want %s", currentToken.AccessToken, "STORED_TOKEN")
+	}
+}
+
+func TestRefreshedTokenIsSaved(t *testing.T) {
+	defer gock.Off()
+	defer SetTokenStore(&MemoryTokenStore{})
+	setTestOauth2Config()
+	store := &MemoryTokenStore{}
+	SetTokenStore(store)
+	currentToken = &oauth2.Token{
+		AccessToken:  "EXPIRED_TOKEN",
+		RefreshToken: "REFRESH_TOKEN",
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+	gock.New(dbAPIBaseURL).
+		Post("/gw/oidc/token").
+		Reply(200).
+		JSON(map[string]interface{}{"access_token": "NEW_TOKEN", "token_type": "bearer", "expires_in": 600})
+	gock.New(dbAPIBaseURL).
+		Get("/gw/dbapi/banking/transactions/v2/").
+		MatchHeader("Authorization", "^Bearer NEW_TOKEN$").
+		Reply(200).
+		BodyString(`{"transactions":[]}`)
+	var transactions DbCashTransactionsList
+	if err := dbAPIRequest("gw/dbapi/banking/transactions/v2/", &transactions); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := store.Load()
+	if saved == nil || saved.AccessToken != "NEW_TOKEN" {
+		t.Errorf("Refreshed token was not saved. Got %v", saved)
+	}
+	if saved != nil && saved.RefreshToken != "REFRESH_TOKEN" {
+		t.Errorf("Refresh token was lost when saving. Got %s want %s", saved.RefreshToken, "REFRESH_TOKEN")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+)
+
+// dryRunResult is what a sync would post to YNAB for one account.
+type dryRunResult struct {
+	Account      string             `json:"account"`
+	Transactions []bank.Transaction `json:"transactions"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// dryRunAccounts gets the transactions for each account from the bank, without
+// posting them to YNAB. Without chunks it gets each account's sync window, with
+// chunks it previews a backfill of them, and stops at the first chunk which
+// fails.
+func dryRunAccounts(toSync []*syncAccount, chunks []dateChunk) ([]dryRunResult, error) {
+	forgetKnownPayees()
+	cachePostedTransactions()
+	defer forgetPostedTransactions()
+	results := make([]dryRunResult, 0, len(toSync))
+	var failed []string
+	for _, account := range toSync {
+		result := dryRunResult{Account: account.Name, Transactions: []bank.Transaction{}}
+		log.Printf("Dry run for account %s", account.Name)
+		windows := chunks
+		if windows == nil {
+			from, to := account.syncWindow(time.Now())
+			windows = []dateChunk{{from: from, to: to}}
+		}
+		for _, window := range windows {
+			if chunks != nil {
+				log.Printf("Dry run for %s to %s", window.from.Format("2006-01-02"), window.to.Format("2006-01-02"))
+			}
+			transactions, err := getTransactions(account, window.from, window.to)
+			if err != nil {
+				log.Printf("Failed to get bank transactions: %s", err)
+				result.Error = err.Error()
+				failed = append(failed, account.Name)
+				break
+			}
+			fetched := transactions
+			if account.SyncPending {
+				transactions = reconcilePending(account, window.from, transactions, true)
+			}
+			transactions = updateCorrected(account, window.from, window.to, fetched, transactions, true)
+			result.Transactions = append(result.Transactions, transactions...)
+			log.Printf("Received %d transactions from bank, not posting them to YNAB", len(transactions))
+		}
+		results = append(results, result)
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("failed dry run for accounts: %s", strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// isDryRun checks if a request asks for a dry run, with ?dry_run or ?dry_run=true.
+// Without the parameter, the configured mode applies.
+func isDryRun(r *http.Request) bool {
+	values, ok := r.URL.Query()["dry_run"]
+	if !ok {
+		return dryRun
+	}
+	if values[0] == "" {
+		return true
+	}
+	requested, err := strconv.ParseBool(values[0])
+	return err == nil && requested
+}
+
+// writeDryRun writes dry run results for an HTTP request, as JSON or with
+// ?format=table as a text table.
+func writeDryRun(w http.ResponseWriter, r *http.Request, results []dryRunResult, err error) {
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+	}
+	if r.URL.Query().Get("format") == "table" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		renderDryRunTable(w, results)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	renderDryRunJSON(w, results)
+}
+
+// renderDryRunJSON writes dry run results as indented JSON.
+func renderDryRunJSON(w io.Writer, results []dryRunResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
+
+// renderDryRunTable writes dry run results as a text table, one transaction per line.
+func renderDryRunTable(w io.Writer, results []dryRunResult) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ACCOUNT\tDATE\tAMOUNT\tPAYEE\tMEMO\tCLEARED\tIMPORT ID")
+	for _, result := range results {
+		if result.Error != "" {
+			fmt.Fprintf(table, "%s\tERROR: %s\t\t\t\t\t\n", result.Account, result.Error)
+			continue
+		}
+		for _, transaction := range result.Transactions {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				result.Account,
+				transaction.Date.Format("2006-01-02"),
+				formatMilliunits(transaction.Amount),
+				stringValue(transaction.PayeeName),
+				stringValue(transaction.Memo),
+				transaction.Cleared,
+				stringValue(transaction.ImportID),
+			)
+		}
+	}
+	return table.Flush()
+}
+
+// formatMilliunits formats a YNAB amount as a decimal with two places.
+func formatMilliunits(amount int64) string {
+	return strconv.FormatFloat(float64(amount)/1000, 'f', 2, 64)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
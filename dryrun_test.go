@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+)
+
+func TestDryRunHandler(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	testConnectorAuthorizeResponse = ""
+	setDummyTransactionResponse()
+	setDummyYnabData()
+	t.Run("Dry runs return the transactions as JSON", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Received HTTP request to /")
+		testLogBuffer.ExpectLog("Dry run for account default")
+		testLogBuffer.ExpectLog("Received 1 transactions from bank, not posting them to YNAB")
+		responseRecorder := runDummyRequest(t, "GET", "/?dry_run", RootHandler)
+		AssertStatus(t, http.StatusOK, responseRecorder.Code)
+		testLogBuffer.TestLogValues(t)
+		var results []dryRunResult
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &results); err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || len(results[0].Transactions) != 1 || *results[0].Transactions[0].ImportID != "import-id" {
+			t.Errorf("Got wrong dry run results: %+v", results)
+		}
+	})
+	t.Run("Dry runs return the transactions as a table", func(t *testing.T) {
+		responseRecorder := runDummyRequest(t, "GET", "/sync?dry_run=true&format=table", RootHandler)
+		AssertStatus(t, http.StatusOK, responseRecorder.Code)
+		expect := "ACCOUNT  DATE        AMOUNT  PAYEE       MEMO  CLEARED  IMPORT ID\n" +
+			"default  2020-05-05  10.00   payee-name        cleared  import-id\n"
+		if got := responseRecorder.Body.String(); got != expect {
+			t.Errorf("Got wrong dry run table. Got %q want %q", got, expect)
+		}
+	})
+	t.Run("The configured dry run mode can be turned off per request", func(t *testing.T) {
+		dryRun = true
+		defer func() { dryRun = false }()
+		if !isDryRun(httptest.NewRequest("GET", "/", nil)) {
+			t.Error("Configured dry run mode was not used")
+		}
+		if isDryRun(httptest.NewRequest("GET", "/?dry_run=false", nil)) {
+			t.Error("Dry run was not turned off by the request")
+		}
+	})
+}
+
+func TestDryRunOnce(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	defer func() { output = os.Stdout }()
+	testConnectorAuthorizeResponse = ""
+	setDummyTransactionResponse()
+	got := &bytes.Buffer{}
+	output = got
+	assertExitCode(t, exitOK, dryRunOnce("", nil, "json"))
+	if !strings.Contains(got.String(), `"import_id": "import-id"`) {
+		t.Errorf("Dry run output is missing the import ID: %s", got.String())
+	}
+}
+
+func TestFormatMilliunits(t *testing.T) {
+	for amount, expect := range map[int64]string{-19050: "-19.05", 10000: "10.00", 1990: "1.99", 0: "0.00"} {
+		if got := formatMilliunits(amount); got != expect {
+			t.Errorf("Got wrong formatted amount for %d. Got %s want %s", amount, got, expect)
+		}
+	}
+}
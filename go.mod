@@ -3,8 +3,13 @@ module github.com/ohthehugemanatee/db-to-ynab-golang
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/go-pascal/iban v0.0.0-20180529131734-f0d46003347e
+	github.com/robfig/cron/v3 v3.0.1
 	go.bmvs.io/ynab v1.3.0
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	gopkg.in/h2non/gock.v1 v1.0.15
+	gopkg.in/yaml.v3 v3.0.0-20200603094226-e3079894b1e8
 )
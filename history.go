@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/history"
+)
+
+// defaultHistoryLimit is how many runs the history shows, unless asked for more.
+const defaultHistoryLimit int = 20
+
+var historySettings config.History
+
+// recordRun adds a finished run to the history, and deletes the runs which are
+// older than the retention. Without a history file, it does nothing.
+func recordRun(run *history.Run, err error) {
+	if historySettings.File == "" {
+		return
+	}
+	run.End = time.Now()
+	if err != nil {
+		run.Error = err.Error()
+	}
+	store, openErr := history.Open(historySettings.File)
+	if openErr != nil {
+		log.Printf("Failed opening the history: %s", openErr)
+		return
+	}
+	defer store.Close()
+	if err := store.Add(run); err != nil {
+		log.Printf("Failed recording the run in the history: %s", err)
+		return
+	}
+	retentionDays := historySettings.RetentionDays
+	if retentionDays == 0 {
+		retentionDays = config.DefaultRetentionDays
+	}
+	if _, err := store.Prune(run.Start.AddDate(0, 0, -retentionDays)); err != nil {
+		log.Printf("Failed deleting old runs from the history: %s", err)
+	}
+}
+
+// repeatedDrift saves the balance drift of an account in the history, and
+// checks if the previous check of the account found the same one. Without a
+// history file, it is only kept by the running process, see
+// syncStatus.repeatedDrift. If the history can't be read, the drift does not
+// count as repeated.
+func repeatedDrift(account string, drift int64) bool {
+	if historySettings.File == "" {
+		return syncState.repeatedDrift(account, drift)
+	}
+	store, err := history.Open(historySettings.File)
+	if err != nil {
+		log.Printf("Failed opening the history: %s", err)
+		return false
+	}
+	defer store.Close()
+	last, found, err := store.LastDrift(account)
+	if err != nil {
+		log.Printf("Failed reading the last balance drift of account %s: %s", account, err)
+		return false
+	}
+	if err := store.SetDrift(account, drift); err != nil {
+		log.Printf("Failed saving the balance drift of account %s: %s", account, err)
+	}
+	return found && last == drift
+}
+
+// listRuns returns the runs in the history which match a filter, newest first.
+func listRuns(filter history.Filter) ([]history.Run, error) {
+	if historySettings.File == "" {
+		return nil, fmt.Errorf("no history is kept, set history.file to record sync runs")
+	}
+	store, err := history.Open(historySettings.File)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.List(filter)
+}
+
+// HistoryHandler handles HTTP requests to /history, listing the last runs as
+// JSON. ?account= only lists the runs of one account, ?limit= sets how many.
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	filter := history.Filter{Account: r.URL.Query().Get("account"), Limit: defaultHistoryLimit}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit %q", limit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = parsed
+	}
+	runs, err := listRuns(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	renderHistoryJSON(w, runs)
+}
+
+func historyCommand(args []string) int {
+	flags := newFlagSet("history")
+	accountName := flags.String("account", "", "show only the runs of the account with this name")
+	limit := flags.Int("limit", defaultHistoryLimit, "how many runs to show, 0 for all")
+	format := flags.String("format", "table", "output format, table or json")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" {
+		log.Printf("Unknown format %s, use table or json", *format)
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	runs, err := listRuns(history.Filter{Account: *accountName, Limit: *limit})
+	if err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+	if *format == "json" {
+		renderHistoryJSON(output, runs)
+	} else {
+		renderHistoryTable(output, runs)
+	}
+	return exitOK
+}
+
+// renderHistoryJSON writes runs as indented JSON.
+func renderHistoryJSON(w io.Writer, runs []history.Run) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(runs)
+}
+
+// renderHistoryTable writes runs as a text table, one account of a run per line.
+func renderHistoryTable(w io.Writer, runs []history.Run) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "RUN\tKIND\tSTART\tDURATION\tACCOUNT\tDATES\tFETCHED\tNEW\tDUPLICATE\tUPDATED\tDRIFT\tERROR")
+	for _, run := range runs {
+		duration := run.End.Sub(run.Start).Round(time.Second)
+		if len(run.Accounts) == 0 {
+			fmt.Fprintf(table, "%d\t%s\t%s\t%s\t\t\t\t\t\t\t\t%s\n", run.ID, run.Kind, run.Start.Local().Format("2006-01-02 15:04"), duration, run.Error)
+		}
+		for _, result := range run.Accounts {
+			drift := ""
+			if result.Drift != 0 {
+				drift = formatMilliunits(result.Drift)
+			}
+			fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%s to %s\t%d\t%d\t%d\t%d\t%s\t%s\n",
+				run.ID,
+				run.Kind,
+				run.Start.Local().Format("2006-01-02 15:04"),
+				duration,
+				result.Account,
+				result.From,
+				result.To,
+				result.Fetched,
+				result.Created,
+				result.Duplicate,
+				result.Updated,
+				drift,
+				result.Error,
+			)
+		}
+	}
+	return table.Flush()
+}
@@ -0,0 +1,205 @@
+// Package history keeps a record of sync runs in a local bbolt database, so we
+// can tell when a sync ran and what it imported.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Kinds of runs.
+const (
+	KindSync     string = "sync"
+	KindBackfill string = "backfill"
+)
+
+// Run is one sync or backfill of one or more accounts.
+type Run struct {
+	ID       uint64       `json:"id"`
+	Kind     string       `json:"kind"`
+	Start    time.Time    `json:"start"`
+	End      time.Time    `json:"end"`
+	Error    string       `json:"error,omitempty"`
+	Accounts []AccountRun `json:"accounts"`
+}
+
+// AccountRun is what a run did for one account, and date range. A backfill
+// has one for every chunk of dates.
+type AccountRun struct {
+	Account   string `json:"account"`
+	Connector string `json:"connector"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Fetched   int    `json:"fetched"`
+	Created   int    `json:"created"`
+	Duplicate int    `json:"duplicate"`
+	Updated   int    `json:"updated"`
+	// ImportIDs are the import IDs of the transactions posted to YNAB.
+	ImportIDs []string `json:"import_ids,omitempty"`
+	// Drift is the difference between the balance at the bank and the
+	// cleared balance in YNAB after the sync, in milliunits, if the balance
+	// was checked and they differed.
+	Drift int64  `json:"drift,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Filter selects the runs List returns.
+type Filter struct {
+	// Account only returns runs of this account, with only its results.
+	Account string
+	// Limit is the most runs to return. Zero returns all.
+	Limit int
+}
+
+var (
+	runsBucket = []byte("runs")
+	// driftsBucket keeps the last balance drift of each account, by account
+	// name, so the next sync can tell if it found the same one, even in
+	// another process. Pruning runs does not delete it.
+	driftsBucket = []byte("drifts")
+)
+
+// Store is a history database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the history database at path, creating it if needed. It waits at
+// most a second for another process using the database.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{runsBucket, driftsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add saves a run, and sets its ID.
+func (s *Store) Add(run *Run) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		run.ID = id
+		value, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key(id), value)
+	})
+}
+
+// List returns the runs which match a filter, newest first.
+func (s *Store) List(filter Filter) ([]Run, error) {
+	runs := []Run{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(runsBucket).Cursor()
+		for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+			if filter.Limit > 0 && len(runs) >= filter.Limit {
+				return nil
+			}
+			var run Run
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			if filter.Account != "" && !run.only(filter.Account) {
+				continue
+			}
+			runs = append(runs, run)
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// Prune deletes the runs which started before a time, and returns how many it
+// deleted.
+func (s *Store) Prune(before time.Time) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(runsBucket).Cursor()
+		// Runs are stored in the order they ran, so the old ones come first.
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var run Run
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			if !run.Start.Before(before) {
+				return nil
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// SetDrift saves the last balance drift of an account. A drift of zero
+// deletes it.
+func (s *Store) SetDrift(account string, drift int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(driftsBucket)
+		if drift == 0 {
+			return bucket.Delete([]byte(account))
+		}
+		return bucket.Put([]byte(account), key(uint64(drift)))
+	})
+}
+
+// LastDrift returns the last balance drift saved for an account, and whether
+// there is one.
+func (s *Store) LastDrift(account string) (drift int64, found bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(driftsBucket).Get([]byte(account))
+		if value == nil {
+			return nil
+		}
+		drift, found = int64(binary.BigEndian.Uint64(value)), true
+		return nil
+	})
+	return drift, found, err
+}
+
+// only keeps the results of one account, and checks if there were any.
+func (r *Run) only(account string) bool {
+	var kept []AccountRun
+	for _, accountRun := range r.Accounts {
+		if accountRun.Account == account {
+			kept = append(kept, accountRun)
+		}
+	}
+	r.Accounts = kept
+	return len(kept) > 0
+}
+
+// key returns the database key of a run ID, which sorts in ID order.
+func key(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
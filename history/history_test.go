@@ -0,0 +1,77 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := Open(filepath.Join(dir, "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Now()
+	for _, run := range []*Run{
+		{Kind: KindBackfill, Start: now.AddDate(0, 0, -100), Accounts: []AccountRun{{Account: "checking"}}},
+		{Kind: KindSync, Start: now.AddDate(0, 0, -1), Accounts: []AccountRun{{Account: "checking", Created: 2}, {Account: "card", Created: 1}}},
+		{Kind: KindSync, Start: now, Accounts: []AccountRun{{Account: "card", Error: "DB API request returned code 500"}}},
+	} {
+		if err := store.Add(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Run("Runs are listed newest first", func(t *testing.T) {
+		runs, err := store.List(Filter{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != 2 || runs[0].ID != 3 || runs[1].ID != 2 {
+			t.Errorf("Got wrong runs. Got %+v want runs 3 and 2", runs)
+		}
+	})
+	t.Run("Runs can be filtered by account", func(t *testing.T) {
+		runs, _ := store.List(Filter{Account: "checking"})
+		if len(runs) != 2 || runs[0].ID != 2 || len(runs[0].Accounts) != 1 || runs[0].Accounts[0].Created != 2 {
+			t.Errorf("Got wrong runs for account checking. Got %+v", runs)
+		}
+	})
+	t.Run("Old runs are pruned", func(t *testing.T) {
+		deleted, err := store.Prune(now.AddDate(0, 0, -90))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != 1 {
+			t.Errorf("Got wrong number of pruned runs. Got %d want 1", deleted)
+		}
+		runs, _ := store.List(Filter{})
+		if len(runs) != 2 {
+			t.Errorf("Got wrong number of runs after pruning. Got %d want 2", len(runs))
+		}
+	})
+	t.Run("The last drift of each account is kept", func(t *testing.T) {
+		if _, found, _ := store.LastDrift("card"); found {
+			t.Error("Found a drift for an account without one")
+		}
+		for _, drift := range []int64{50000, -1250} {
+			if err := store.SetDrift("card", drift); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if drift, found, err := store.LastDrift("card"); err != nil || !found || drift != -1250 {
+			t.Errorf("Got wrong last drift. Got %d, %t, %v want -1250", drift, found, err)
+		}
+		store.SetDrift("card", 0)
+		if _, found, _ := store.LastDrift("card"); found {
+			t.Error("Drift of zero was kept")
+		}
+	})
+}
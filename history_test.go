@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/history"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+)
+
+func TestHistory(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	testConnectorAuthorizeResponse = ""
+	setDummyYnabData()
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	historySettings = config.History{File: filepath.Join(dir, "history.db")}
+	defer func() { historySettings = config.History{} }()
+	tools.CreateAndActivateEmptyTestLogBuffer()
+	syncOnce("")
+	testConnectorGetTransactionsResponseError = errors.New("This is a test error")
+	syncOnce("")
+	testConnectorGetTransactionsResponseError = nil
+	t.Run("Runs are listed on /history", func(t *testing.T) {
+		responseRecorder := runDummyRequest(t, "GET", "/history?limit=1", HistoryHandler)
+		AssertStatus(t, http.StatusOK, responseRecorder.Code)
+		var runs []history.Run
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &runs); err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != 1 {
+			t.Fatalf("Got wrong number of runs. Got %d want 1", len(runs))
+		}
+		run := runs[0]
+		if run.Kind != history.KindSync || run.Error != "failed syncing accounts: default" || run.End.IsZero() {
+			t.Errorf("Got wrong run: %+v", run)
+		}
+		if len(run.Accounts) != 1 || run.Accounts[0].Connector != "main.testConnector" || run.Accounts[0].Error != "This is a test error" {
+			t.Errorf("Got wrong account results: %+v", run.Accounts)
+		}
+	})
+	t.Run("Invalid limits are refused", func(t *testing.T) {
+		responseRecorder := runDummyRequest(t, "GET", "/history?limit=all", HistoryHandler)
+		AssertStatus(t, http.StatusBadRequest, responseRecorder.Code)
+	})
+	t.Run("Runs are rendered as a table, newest first", func(t *testing.T) {
+		runs, err := listRuns(history.Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := &bytes.Buffer{}
+		renderHistoryTable(got, runs)
+		lines := strings.Split(strings.TrimSpace(got.String()), "\n")
+		if len(lines) != 3 || !strings.HasPrefix(lines[0], "RUN") || !strings.HasPrefix(lines[1], "2 ") || !strings.HasSuffix(lines[1], "This is a test error") {
+			t.Errorf("Got wrong history table:\n%s", got.String())
+		}
+	})
+}
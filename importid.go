@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"go.bmvs.io/ynab/api/transaction"
+)
+
+// setYNABImportIDs replaces the import IDs of transactions with the format of
+// YNAB's file imports, so they match transactions imported that way. YNAB
+// counts occurrences of each amount on each date. We count them in order of the
+// connector's import IDs, so they are the same on every sync. Pending
+// transactions keep their import IDs and are not counted, as file imports have
+// no pending transactions and the booked transaction replaces them.
+func setYNABImportIDs(transactions []bank.Transaction) {
+	groups := make(map[string][]int)
+	for i, transaction := range transactions {
+		if transaction.Details.Pending {
+			continue
+		}
+		key := tools.CreateYNABImportID(transaction.Amount, transaction.Date.Format("2006-01-02"), 0)
+		groups[key] = append(groups[key], i)
+	}
+	for _, indexes := range groups {
+		sort.SliceStable(indexes, func(a, b int) bool {
+			return importIDValue(transactions[indexes[a]]) < importIDValue(transactions[indexes[b]])
+		})
+		for occurrence, i := range indexes {
+			importID := tools.CreateYNABImportID(transactions[i].Amount, transactions[i].Date.Format("2006-01-02"), occurrence+1)
+			transactions[i].ImportID = &importID
+		}
+	}
+}
+
+func importIDValue(transaction bank.Transaction) string {
+	if transaction.ImportID == nil {
+		return ""
+	}
+	return *transaction.ImportID
+}
+
+// legacyImportIDsGone keeps, for each account, the earliest date since which
+// YNAB had none of the fetched transactions' legacy import IDs. New transactions
+// never get legacy import IDs, so later windows need not be checked again.
+var legacyImportIDsGone = struct {
+	sync.Mutex
+	since map[string]time.Time
+}{}
+
+// keepLegacyImportIDs gives transactions which are in YNAB with the import ID
+// an earlier version gave them that import ID again, so they are not created a
+// second time. Several transactions can have the same legacy import ID, each
+// one in YNAB goes to the transaction with its payee, or else the first one.
+func keepLegacyImportIDs(account *syncAccount, from time.Time, transactions []bank.Transaction) {
+	legacy := make(map[string]bool)
+	for _, transaction := range transactions {
+		if transaction.LegacyImportID != "" {
+			legacy[transaction.LegacyImportID] = true
+		}
+	}
+	if len(legacy) == 0 || legacyImportIDsChecked(account, from) {
+		return
+	}
+	existing, err := postedSince(account, from)
+	if err != nil {
+		log.Printf("Failed getting YNAB transactions, not checking for import IDs of earlier versions: %s", err)
+		return
+	}
+	imported := make(map[string]bool)
+	for _, posted := range existing {
+		if posted.ImportID != nil {
+			imported[*posted.ImportID] = true
+		}
+	}
+	found := false
+	for _, posted := range existing {
+		if posted.ImportID == nil || !legacy[*posted.ImportID] {
+			continue
+		}
+		found = true
+		if i := legacyImportIDOwner(posted, transactions, imported); i >= 0 {
+			importID := *posted.ImportID
+			transactions[i].ImportID = &importID
+		}
+	}
+	if !found {
+		legacyImportIDsGoneSince(account, from)
+	}
+}
+
+// legacyImportIDsChecked checks if YNAB had no legacy import IDs of the account
+// on an earlier run, over a window which started no later than from.
+func legacyImportIDsChecked(account *syncAccount, from time.Time) bool {
+	legacyImportIDsGone.Lock()
+	defer legacyImportIDsGone.Unlock()
+	since, ok := legacyImportIDsGone.since[account.Name]
+	return ok && !from.Before(since)
+}
+
+// legacyImportIDsGoneSince records that YNAB has no legacy import IDs of the
+// account's transactions since from.
+func legacyImportIDsGoneSince(account *syncAccount, from time.Time) {
+	legacyImportIDsGone.Lock()
+	defer legacyImportIDsGone.Unlock()
+	if legacyImportIDsGone.since == nil {
+		legacyImportIDsGone.since = make(map[string]time.Time)
+	}
+	if since, ok := legacyImportIDsGone.since[account.Name]; !ok || from.Before(since) {
+		legacyImportIDsGone.since[account.Name] = from
+	}
+}
+
+// legacyImportIDOwner returns the index of the transaction which was imported
+// as a YNAB transaction with a legacy import ID, or -1. Transactions which are
+// in YNAB with their own import ID are skipped.
+func legacyImportIDOwner(posted *transaction.Transaction, transactions []bank.Transaction, imported map[string]bool) int {
+	owner := -1
+	for i, candidate := range transactions {
+		if candidate.LegacyImportID != *posted.ImportID || imported[importIDValue(candidate)] {
+			continue
+		}
+		if posted.PayeeName != nil && stringValue(candidate.PayeeName) == *posted.PayeeName {
+			return i
+		}
+		if owner < 0 || importIDValue(candidate) < importIDValue(transactions[owner]) {
+			owner = i
+		}
+	}
+	return owner
+}
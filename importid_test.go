@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"go.bmvs.io/ynab/api"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestGetTransactionsImportIDs(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	date, _ := api.DateFromString("2019-11-04")
+	otherDate, _ := api.DateFromString("2019-11-05")
+	importIDs := []string{"b-hash", "a-hash", "c-hash", bank.PendingImportIDPrefix + "0123456789abcdef0123456789ab"}
+	testConnectorGetTransactionsResponse = []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -3500, ImportID: &importIDs[0]}},
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -3500, ImportID: &importIDs[1]}},
+		{PayloadTransaction: ynabTransaction{Date: otherDate, Amount: -3500, ImportID: &importIDs[2]}},
+		{PayloadTransaction: ynabTransaction{Date: otherDate, Amount: -3500, ImportID: &importIDs[3]}, Details: bank.Details{Pending: true}},
+	}
+	t.Run("Hash import IDs are kept by default", func(t *testing.T) {
+		transactions, _ := getTransactions(accounts[0], time.Now(), time.Now())
+		assertImportIDs(t, transactions, importIDs)
+	})
+	t.Run("YNAB import IDs count occurrences per amount and date, without pending transactions", func(t *testing.T) {
+		accounts[0].ImportIDFormat = config.ImportIDFormatYNAB
+		transactions, _ := getTransactions(accounts[0], time.Now(), time.Now())
+		assertImportIDs(t, transactions, []string{"YNAB:-3500:2019-11-04:2", "YNAB:-3500:2019-11-04:1", "YNAB:-3500:2019-11-05:1", importIDs[3]})
+	})
+}
+
+func assertImportIDs(t *testing.T, transactions []bank.Transaction, expect []string) {
+	if len(transactions) != len(expect) {
+		t.Fatalf("Got wrong number of transactions. Got %d want %d", len(transactions), len(expect))
+	}
+	for i, transaction := range transactions {
+		if *transaction.ImportID != expect[i] {
+			t.Errorf("Got wrong import ID. Got %s want %s", *transaction.ImportID, expect[i])
+		}
+	}
+}
+
+func TestGetTransactionsTemplates(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	defer func() { accounts[0].PayeeTemplate, accounts[0].MemoTemplate = "", "" }()
+	payee := "Rewe"
+	testConnectorGetTransactionsResponse = []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{PayeeName: &payee}, Details: bank.Details{CounterPartyName: payee, PaymentReference: "Lebensmittel"}},
+	}
+	accounts[0].PayeeTemplate = "{{.Payee}} Markt"
+	accounts[0].MemoTemplate = "{{.PaymentReference}}"
+	transactions, err := getTransactions(accounts[0], time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *transactions[0].PayeeName != "Rewe Markt" || *transactions[0].Memo != "Lebensmittel" {
+		t.Errorf("Got wrong payee and memo. Got %s, %s", *transactions[0].PayeeName, *transactions[0].Memo)
+	}
+}
+
+func TestKeepLegacyImportIDs(t *testing.T) {
+	setDummyConnector(true)
+	setDummyYnabData()
+	defer gock.Off()
+	date, _ := api.DateFromString("2020-03-04")
+	coffee, bakery, newCoffee, newBakery, legacyID := "Coffee Shop", "Bakery", "coffee-import-id", "bakery-import-id", "legacy-import-id"
+	transactions := []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -3500, PayeeName: &bakery, ImportID: &newBakery}, LegacyImportID: legacyID},
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -3500, PayeeName: &coffee, ImportID: &newCoffee}, LegacyImportID: legacyID},
+	}
+	gock.New("https://api.youneedabudget.com/").
+		Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+		MatchParam("since_date", "2020-03-01").
+		Reply(200).
+		BodyString(`{"data":{"transactions":[
+			{"id":"coffee-id","date":"2020-03-04","amount":-3500,"cleared":"cleared","payee_name":"Coffee Shop","import_id":"legacy-import-id"}
+		]}}`)
+	keepLegacyImportIDs(accounts[0], time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), transactions)
+	assertImportIDs(t, transactions, []string{newBakery, legacyID})
+	t.Run("Windows are not checked again once YNAB has no legacy import IDs", func(t *testing.T) {
+		defer func() { legacyImportIDsGone.since = nil }()
+		transactions[1].ImportID = &newCoffee
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+			MatchParam("since_date", "2020-03-05").
+			Reply(200).
+			BodyString(`{"data":{"transactions":[]}}`)
+		keepLegacyImportIDs(accounts[0], time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC), transactions)
+		if !gock.IsDone() {
+			t.Fatal("YNAB was not checked for legacy import IDs")
+		}
+		keepLegacyImportIDs(accounts[0], time.Date(2020, 3, 6, 0, 0, 0, 0, time.UTC), transactions)
+		if gock.HasUnmatchedRequest() {
+			t.Error("YNAB was checked again for a later window")
+		}
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+			MatchParam("since_date", "2020-03-01").
+			Reply(200).
+			BodyString(`{"data":{"transactions":[]}}`)
+		keepLegacyImportIDs(accounts[0], time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), transactions)
+		if !gock.IsDone() {
+			t.Error("YNAB was not checked for an earlier window, as for a backfill")
+		}
+		assertImportIDs(t, transactions, []string{newBakery, newCoffee})
+	})
+}
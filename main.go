@@ -2,11 +2,18 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
 	"github.com/ohthehugemanatee/db-to-ynab-golang/dbapi"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/history"
 	"go.bmvs.io/ynab"
 	"go.bmvs.io/ynab/api/transaction"
 )
@@ -15,12 +22,10 @@ type ynabTransaction = transaction.PayloadTransaction
 
 // BankConnector is the interface for any bank account connection.
 type BankConnector interface {
-	// Returns an error if any connector parameters are missing/invalid.
-	CheckParams() error
 	// Checks if the account number is valid for this connector.
 	IsValidAccountNumber(string) (bool, error)
-	// Gets YNAB formatted transactions.
-	GetTransactions(string) ([]ynabTransaction, error)
+	// Gets YNAB formatted transactions booked between two dates, with their bank details.
+	GetTransactions(account config.Account, from time.Time, to time.Time) ([]bank.Transaction, error)
 	// Returns an oauth authorization url if necessary.
 	Authorize() string
 	// Handles an oauth response if necessary
@@ -29,83 +34,315 @@ type BankConnector interface {
 
 const networkAddress string = ":3000"
 
+// syncAccount is a configured account with its elected connector.
+type syncAccount struct {
+	config.Account
+	connector BankConnector
+}
+
 var (
-	ynabSecret          string          = os.Getenv("YNAB_SECRET")
-	ynabBudgetID        string          = os.Getenv("YNAB_BUDGET_ID")
-	ynabAccountID       string          = os.Getenv("YNAB_ACCOUNT_ID")
-	accountNumber       string          = os.Getenv("DB_ACCOUNT")
+	configFile          string          = os.Getenv("CONFIG_FILE")
 	availableConnectors []BankConnector = []BankConnector{
 		dbapi.DbCashConnector{},
 		dbapi.DbCreditConnector{},
 	}
-	activeConnector BankConnector
+	ynabSecret       string
+	accounts         []*syncAccount
+	dbSettings       config.DB
+	dryRun           bool
+	scheduleSettings config.Schedule
+	syncScheduler    *scheduler
 	// Fatal error handler defined by variable so we can replace it in tests.
 	fatalError = log.Fatal
 )
 
 func main() {
-	electConnectorOrFatal()
-	checkParamsOrFatal()
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+// serve syncs on HTTP requests and the configured schedule.
+func serve() {
+	loadConfigOrFatal()
+	resolveCategoriesOrFatal()
+	electConnectorsOrFatal()
+	loadTokenStoreOrFatal()
 	registerHandlers()
+	startSchedulerOrFatal()
 	fatalError(http.ListenAndServe(networkAddress, nil))
 	log.Print("DB/YNAB sync server started, listening on port 3000.")
 }
 
-func electConnectorOrFatal() {
-	var err error
-	activeConnector, err = GetConnector(accountNumber)
+// loadConfigOrFatal loads and validates the config file and environment.
+func loadConfigOrFatal() {
+	if err := loadConfig(); err != nil {
+		fatalError(err)
+	}
+}
+
+// loadConfig loads and validates the config file and environment.
+func loadConfig() error {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := loadRules(cfg.RulesFile); err != nil {
+		return err
+	}
+	applyConfig(cfg)
+	return nil
+}
+
+// applyConfig sets up YNAB, the bank connection and the accounts to sync.
+func applyConfig(cfg *config.Config) {
+	ynabSecret = cfg.YNAB.Secret
+	dbapi.Configure(cfg.DB)
+	dbSettings = cfg.DB
+	scheduleSettings = cfg.Schedule
+	dryRun = cfg.DryRun
+	categorizerSettings = cfg.Categorizer
+	balanceCheckSettings = cfg.BalanceCheck
+	historySettings = cfg.History
+	settlementDays = cfg.SettlementDays
+	if settlementDays == 0 {
+		settlementDays = config.DefaultSettlementDays
+	}
+	settlementReference = regexp.MustCompile(config.DefaultSettlementReference)
+	if cfg.SettlementReference != "" {
+		settlementReference = regexp.MustCompile(cfg.SettlementReference)
+	}
+	lookbackDays := cfg.LookbackDays
+	if lookbackDays == 0 {
+		lookbackDays = config.DefaultLookbackDays
+	}
+	accounts = nil
+	for _, account := range cfg.Accounts {
+		if account.LookbackDays == 0 {
+			account.LookbackDays = lookbackDays
+		}
+		if account.Currency == "" {
+			account.Currency = config.DefaultCurrency
+		}
+		accounts = append(accounts, &syncAccount{Account: account})
+	}
+}
+
+func electConnectorsOrFatal() {
+	if err := electConnectors(); err != nil {
+		fatalError(err)
+	}
+}
+
+// electConnectors finds the connector for each account.
+func electConnectors() error {
+	for _, account := range accounts {
+		connector, err := GetConnector(account.Number)
+		if err != nil {
+			return err
+		}
+		account.connector = connector
+		log.Printf("Connector %T elected for account %s", connector, account.Name)
+	}
+	return nil
+}
+
+func loadTokenStoreOrFatal() {
+	err := dbapi.LoadTokenStore()
 	if err != nil {
 		fatalError(err)
 		return
 	}
-	log.Printf("Connector %T elected", activeConnector)
 }
 
-func checkParamsOrFatal() {
-	err := activeConnector.CheckParams()
+// startSchedulerOrFatal starts syncing on the configured schedule, if there is one.
+func startSchedulerOrFatal() {
+	var err error
+	syncScheduler, err = newScheduler(scheduleSettings, scheduledSync)
 	if err != nil {
 		fatalError(err)
 		return
 	}
+	if syncScheduler == nil {
+		log.Print("No sync schedule is set, syncing only on HTTP requests")
+		return
+	}
+	syncScheduler.Start()
+	log.Print("Scheduled syncing started")
 }
 
 func registerHandlers() {
 	http.HandleFunc("/", RootHandler)
-	http.HandleFunc("/authorized", activeConnector.AuthorizedHandler)
+	http.HandleFunc("/sync", RootHandler)
+	http.HandleFunc("/sync/", SyncAccountHandler)
+	http.HandleFunc("/status", StatusHandler)
+	http.HandleFunc("/history", HistoryHandler)
+	// All accounts share one bank session, so the first connector can handle
+	// the oauth response for all of them.
+	http.HandleFunc("/authorized", accounts[0].connector.AuthorizedHandler)
 }
 
-// RootHandler handles HTTP requests to /
+// RootHandler handles HTTP requests to / and /sync, syncing all accounts.
 func RootHandler(w http.ResponseWriter, r *http.Request) {
-	log.Print("Received HTTP request to /")
-	if url := activeConnector.Authorize(); url != "" {
+	log.Printf("Received HTTP request to %s", r.URL.Path)
+	syncAccounts(w, r, accounts)
+}
+
+// SyncAccountHandler handles HTTP requests to /sync/{name}, syncing one account.
+func SyncAccountHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received HTTP request to %s", r.URL.Path)
+	name := strings.TrimPrefix(r.URL.Path, "/sync/")
+	account := findAccount(name)
+	if account == nil {
+		log.Printf("No account named %s", name)
+		http.NotFound(w, r)
+		return
+	}
+	syncAccounts(w, r, []*syncAccount{account})
+}
+
+// syncAccounts syncs the accounts for an HTTP request, after making sure we are authorized.
+func syncAccounts(w http.ResponseWriter, r *http.Request, toSync []*syncAccount) {
+	if url := authorizeURL(toSync); url != "" {
 		log.Printf("We are not yet authorized, redirecting to %s", url)
 		http.Redirect(w, r, url, http.StatusFound)
 		return
 	}
-	convertedTransactions, err := activeConnector.GetTransactions(accountNumber)
+	if isDryRun(r) {
+		results, err := dryRunAccounts(toSync, nil)
+		writeDryRun(w, r, results, err)
+		return
+	}
+	err := runSync(toSync)
+	if err == errSyncInProgress {
+		log.Print("A sync is already in progress, not starting another one")
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to get bank transactions: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
-		return
 	}
+}
+
+// authorizeURL returns the authorization URL of the first connector which needs one.
+func authorizeURL(toSync []*syncAccount) string {
+	for _, account := range toSync {
+		if url := account.connector.Authorize(); url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+// runSync syncs each account in turn. Only one sync runs at a time, any other
+// returns errSyncInProgress.
+func runSync(toSync []*syncAccount) (err error) {
+	if !syncState.begin() {
+		return errSyncInProgress
+	}
+	run := &history.Run{Kind: history.KindSync, Start: time.Now()}
+	forgetKnownPayees()
+	cachePostedTransactions()
+	defer func() {
+		forgetPostedTransactions()
+		syncState.end(err)
+		recordRun(run, err)
+	}()
+	var failed []string
+	for _, account := range toSync {
+		from, to := account.syncWindow(time.Now())
+		result, err := syncAccountTransactions(account, from, to)
+		run.Accounts = append(run.Accounts, result)
+		if err != nil {
+			failed = append(failed, account.Name)
+			continue
+		}
+		run.Accounts[len(run.Accounts)-1].Drift = checkBalance(account).Drift
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed syncing accounts: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// syncWindow returns the booking dates a regular sync gets, ending on now.
+func (account *syncAccount) syncWindow(now time.Time) (from time.Time, to time.Time) {
+	lookbackDays := account.LookbackDays
+	if lookbackDays == 0 {
+		lookbackDays = config.DefaultLookbackDays
+	}
+	return now.AddDate(0, 0, -lookbackDays), now
+}
+
+// syncAccountTransactions gets transactions booked between from and to for
+// one account from the bank and posts them to YNAB. It returns what it did, for
+// the history.
+func syncAccountTransactions(account *syncAccount, from time.Time, to time.Time) (result history.AccountRun, err error) {
+	result = history.AccountRun{
+		Account:   account.Name,
+		Connector: fmt.Sprintf("%T", account.connector),
+		From:      from.Format("2006-01-02"),
+		To:        to.Format("2006-01-02"),
+	}
+	defer func() {
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}()
+	log.Printf("Syncing account %s", account.Name)
+	convertedTransactions, err := getTransactions(account, from, to)
+	if err != nil {
+		log.Printf("Failed to get bank transactions: %s", err)
+		return result, err
+	}
+	fetchedTransactions := convertedTransactions
+	if account.SyncPending {
+		convertedTransactions = reconcilePending(account, from, convertedTransactions, false)
+	}
+	convertedTransactions = updateCorrected(account, from, to, fetchedTransactions, convertedTransactions, false)
 	transactionsCount := len(convertedTransactions)
+	result.Fetched = transactionsCount
 	log.Printf("Received %d transactions from bank", transactionsCount)
 	if transactionsCount == 0 {
 		log.Print("Ending run")
-		return
+		return result, nil
 	}
 	log.Print("Posting transactions to YNAB")
-	createdTransactions, err := postTransactionsToYNAB(ynabSecret, ynabBudgetID, convertedTransactions)
+	createdTransactions, err := postTransactionsToYNAB(ynabSecret, account.YNABBudgetID, bank.Payloads(convertedTransactions))
 	if err != nil {
 		log.Printf("Failed submitting transactions to YNAB: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return result, err
 	}
+	rememberCreated(account, createdTransactions.Transactions)
 	createdCount := len(createdTransactions.TransactionIDs)
 	duplicateCount := len(createdTransactions.DuplicateImportIDs)
 	savedCount := len(createdTransactions.Transactions)
+	result.Created, result.Duplicate = createdCount, duplicateCount
+	for _, transaction := range convertedTransactions {
+		if transaction.ImportID != nil {
+			result.ImportIDs = append(result.ImportIDs, *transaction.ImportID)
+		}
+	}
 
+	if duplicateCount > 0 {
+		result.Updated = updateChangedTransactions(account, from, convertedTransactions, createdTransactions.DuplicateImportIDs)
+		if result.Updated > 0 {
+			log.Printf("Updated %d duplicate transactions which the bank changed", result.Updated)
+		}
+	}
 	log.Printf("Posted transactions to YNAB, %d new, %d duplicate, %d saved. Ending run", createdCount, duplicateCount, savedCount)
+	return result, nil
+}
+
+// findAccount returns the account with the given name, or nil.
+func findAccount(name string) *syncAccount {
+	for _, account := range accounts {
+		if account.Name == name {
+			return account
+		}
+	}
+	return nil
 }
 
 // GetConnector returns the first connector where the account number is valid.
@@ -5,9 +5,13 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
 	"github.com/ohthehugemanatee/db-to-ynab-golang/dbapi"
 	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
 	"go.bmvs.io/ynab/api"
@@ -16,36 +20,32 @@ import (
 )
 
 const (
-	goodIban                   string = "DE49500105178844289951"
-	badIban                    string = "DE10010000000111106136"
-	dummyYnabAccountID         string = "f2b9e2c0-f927-2aa3-f2cf-f227d22fa7f9"
-	dummyYnabBudgetID          string = "b25f2ff7-5fba-f332-f4a2-24f32f02f857"
-	dummyYnabSecret            string = "bb97fbf01ebbfbd73fff33bfdcbf7bf30fbfb7f9b5dfea5c5ffb04bb52eb366b"
-	badParamsConnectorResponse string = "Bwahaha you will NEVER pass my CheckParams test!"
+	goodIban           string = "DE49500105178844289951"
+	badIban            string = "DE10010000000111106136"
+	dummyYnabAccountID string = "f2b9e2c0-f927-2aa3-f2cf-f227d22fa7f9"
+	dummyYnabBudgetID  string = "b25f2ff7-5fba-f332-f4a2-24f32f02f857"
+	dummyYnabSecret    string = "bb97fbf01ebbfbd73fff33bfdcbf7bf30fbfb7f9b5dfea5c5ffb04bb52eb366b"
 )
 
 var (
 	AuthorizedHandlerWasHit                        bool
 	testConnectorAuthorizeResponse                 string = "https://example.com/"
-	testConnectorCheckParamsError                  error
-	testConnectorIsValidAccountNumberResponse      bool = true
+	testConnectorIsValidAccountNumberResponse      bool   = true
 	testConnectorIsValidAccountNumberResponseError error
-	testConnectorGetTransactionsResponse           []ynabTransaction
+	testConnectorGetTransactionsResponse           []bank.Transaction
 	testConnectorGetTransactionsResponseError      error
+	testConnectorGetTransactionsWindows            [][2]time.Time
 )
 
 type testConnector struct {
 }
 
-func (c testConnector) CheckParams() error {
-	return testConnectorCheckParamsError
-}
-
 func (c testConnector) IsValidAccountNumber(a string) (bool, error) {
 	return testConnectorIsValidAccountNumberResponse, testConnectorIsValidAccountNumberResponseError
 }
 
-func (c testConnector) GetTransactions(string) ([]ynabTransaction, error) {
+func (c testConnector) GetTransactions(account config.Account, from time.Time, to time.Time) ([]bank.Transaction, error) {
+	testConnectorGetTransactionsWindows = append(testConnectorGetTransactionsWindows, [2]time.Time{from, to})
 	return testConnectorGetTransactionsResponse, testConnectorGetTransactionsResponseError
 }
 func (c testConnector) Authorize() string {
@@ -61,38 +61,27 @@ func TestElectAndConfigureConnector(t *testing.T) {
 	originalFatalError := fatalError
 	defer func() { fatalError = originalFatalError }()
 	fatalError = func(v ...interface{}) {
-		log.Print(v)
+		log.Printf("%v", v)
 	}
 	t.Run("Test failure in connector election", func(t *testing.T) {
-		activeConnector = nil
+		setDummyConnector(false)
 		availableConnectors = []BankConnector{}
 		logBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
 		logBuffer.ExpectLog("[Account number is not recognized by any connector, cannot proceed without a compatible connector]")
-		electConnectorOrFatal()
+		electConnectorsOrFatal()
 		logBuffer.TestLogValues(t)
 	})
 	t.Run("Test connector election", func(t *testing.T) {
-		setDummyConnector(true)
+		setDummyConnector(false)
 		defer resetTestConnectorResponses()
 		logBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
-		logBuffer.ExpectLog("Connector main.testConnector elected")
-		electConnectorOrFatal()
-		if activeConnector == nil {
+		logBuffer.ExpectLog("Connector main.testConnector elected for account default")
+		electConnectorsOrFatal()
+		if accounts[0].connector == nil {
 			t.Error("Connector was not elected")
 		}
 		logBuffer.TestLogValues(t)
 	})
-	t.Run("Test connector configuration failure", func(t *testing.T) {
-		setDummyConnector(false)
-		defer resetTestConnectorResponses()
-		testConnectorCheckParamsError = errors.New(badParamsConnectorResponse)
-		logBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
-		logBuffer.ExpectLog("Connector main.testConnector elected")
-		logBuffer.ExpectLog("[" + badParamsConnectorResponse + "]")
-		electConnectorOrFatal()
-		checkParamsOrFatal()
-		logBuffer.TestLogValues(t)
-	})
 }
 
 func TestRootHandler(t *testing.T) {
@@ -100,7 +89,6 @@ func TestRootHandler(t *testing.T) {
 	defer resetTestConnectorResponses()
 	t.Run("Test redirect to authorize url", func(t *testing.T) {
 		expectedURL := "https://example.com/"
-		activeConnector = testConnector{}
 		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
 		testLogBuffer.ExpectLog("Received HTTP request to /")
 		testLogBuffer.ExpectLog("We are not yet authorized, redirecting to https://example.com/")
@@ -127,8 +115,13 @@ func TestRootHandler(t *testing.T) {
 				Reply(200).
 				AddHeader("X-Rate-Limit", "36/200").
 				BodyString(`{"data":{"transaction_ids":["string"],"transaction":{"id":"string","date":"2006-01-02","amount":0,"memo":"string","cleared":"cleared","approved":true,"flag_color":"red","account_id":"string","payee_id":"string","category_id":"string","transfer_account_id":"string","transfer_transaction_id":"string","matched_transaction_id":"string","import_id":"string","deleted":true,"account_name":"string","payee_name":"string","category_name":"string","subtransactions":[{"id":"string","transaction_id":"string","amount":0,"memo":"string","payee_id":"string","payee_name":"string","category_id":"string","category_name":"string","transfer_account_id":"string","transfer_transaction_id":"string","deleted":true}]},"transactions":[{"id":"string","date":"2006-01-02","amount":0,"memo":"string","cleared":"cleared","approved":true,"flag_color":"red","account_id":"string","payee_id":"string","category_id":"string","transfer_account_id":"string","transfer_transaction_id":"string","matched_transaction_id":"string","import_id":"string","deleted":true,"account_name":"string","payee_name":"string","category_name":"string","subtransactions":[{"id":"string","transaction_id":"string","amount":0,"memo":"string","payee_id":"string","payee_name":"string","category_id":"string","category_name":"string","transfer_account_id":"string","transfer_transaction_id":"string","deleted":true}]}],"duplicate_import_ids":["string"],"server_knowledge":0}}`)
+			gock.New("https://api.youneedabudget.com/").
+				Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/" + dummyYnabAccountID + "/transactions").
+				Reply(200).
+				BodyString(`{"data":{"transactions":[]}}`)
 
 			testLogBuffer.ExpectLog("Received HTTP request to /")
+			testLogBuffer.ExpectLog("Syncing account default")
 			testLogBuffer.ExpectLog("Received 1 transactions from bank")
 			testLogBuffer.ExpectLog("Posting transactions to YNAB")
 			testLogBuffer.ExpectLog("Posted transactions to YNAB, 1 new, 1 duplicate, 1 saved. Ending run")
@@ -141,6 +134,7 @@ func TestRootHandler(t *testing.T) {
 			testConnectorGetTransactionsResponseError = errors.New(testErrorMsg)
 			testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
 			testLogBuffer.ExpectLog("Received HTTP request to /")
+			testLogBuffer.ExpectLog("Syncing account default")
 			testLogBuffer.ExpectLog("Failed to get bank transactions: " + testErrorMsg)
 			responseRecorder := runDummyRequest(t, "GET", "/", RootHandler)
 			AssertStatus(t, http.StatusInternalServerError, responseRecorder.Code)
@@ -159,6 +153,7 @@ func TestRootHandler(t *testing.T) {
 				BodyString(testErrorMsg)
 			testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
 			testLogBuffer.ExpectLog("Received HTTP request to /")
+			testLogBuffer.ExpectLog("Syncing account default")
 			testLogBuffer.ExpectLog("Received 1 transactions from bank")
 			testLogBuffer.ExpectLog("Posting transactions to YNAB")
 			testLogBuffer.ExpectLog("Failed submitting transactions to YNAB: api: error id=500 name=unknown_api_error detail=Unknown API error")
@@ -169,11 +164,97 @@ func TestRootHandler(t *testing.T) {
 	})
 }
 
+func TestSyncAccountHandler(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	testConnectorAuthorizeResponse = ""
+	setDummyYnabData()
+	secondAccount := &syncAccount{
+		Account: config.Account{
+			Name:          "savings",
+			Number:        goodIban,
+			YNABBudgetID:  dummyYnabBudgetID,
+			YNABAccountID: dummyYnabAccountID,
+		},
+		connector: testConnector{},
+	}
+	accounts = append(accounts, secondAccount)
+	t.Run("Test syncing all accounts", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Received HTTP request to /sync")
+		testLogBuffer.ExpectLog("Syncing account default")
+		testLogBuffer.ExpectLog("Received 0 transactions from bank")
+		testLogBuffer.ExpectLog("Ending run")
+		testLogBuffer.ExpectLog("Syncing account savings")
+		testLogBuffer.ExpectLog("Received 0 transactions from bank")
+		testLogBuffer.ExpectLog("Ending run")
+		responseRecorder := runDummyRequest(t, "GET", "/sync", RootHandler)
+		AssertStatus(t, http.StatusOK, responseRecorder.Code)
+		testLogBuffer.TestLogValues(t)
+	})
+	t.Run("Test syncing one account", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Received HTTP request to /sync/savings")
+		testLogBuffer.ExpectLog("Syncing account savings")
+		testLogBuffer.ExpectLog("Received 0 transactions from bank")
+		testLogBuffer.ExpectLog("Ending run")
+		responseRecorder := runDummyRequest(t, "GET", "/sync/savings", SyncAccountHandler)
+		AssertStatus(t, http.StatusOK, responseRecorder.Code)
+		testLogBuffer.TestLogValues(t)
+	})
+	t.Run("Test syncing an unknown account", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Received HTTP request to /sync/checking")
+		testLogBuffer.ExpectLog("No account named checking")
+		responseRecorder := runDummyRequest(t, "GET", "/sync/checking", SyncAccountHandler)
+		AssertStatus(t, http.StatusNotFound, responseRecorder.Code)
+		testLogBuffer.TestLogValues(t)
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	originalFatalError := fatalError
+	defer func() { fatalError = originalFatalError }()
+	fatalError = func(v ...interface{}) {
+		log.Printf("%v", v)
+	}
+	configFile = ""
+	env := map[string]string{
+		"YNAB_SECRET":              dummyYnabSecret,
+		"DB_CLIENT_ID":             "client-id",
+		"DB_CLIENT_SECRET":         "client-secret",
+		"DB_API_ENDPOINT_HOSTNAME": "https://example.com/",
+		"REDIRECT_BASE_URL":        "http://localhost:3000/",
+		"DB_ACCOUNT":               goodIban,
+		"YNAB_BUDGET_ID":           dummyYnabBudgetID,
+		"YNAB_ACCOUNT_ID":          dummyYnabAccountID,
+	}
+	t.Run("Test invalid config is refused", func(t *testing.T) {
+		logBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		logBuffer.ExpectLog("[ynab.secret: missing value, set it in the config file or with the YNAB_SECRET environment variable]")
+		loadConfigOrFatal()
+		logBuffer.TestLogValues(t)
+	})
+	t.Run("Test loading a single account from the environment", func(t *testing.T) {
+		for variable, value := range env {
+			os.Setenv(variable, value)
+			defer os.Unsetenv(variable)
+		}
+		loadConfigOrFatal()
+		if len(accounts) != 1 || accounts[0].Name != config.DefaultAccountName || accounts[0].Number != goodIban {
+			t.Errorf("Did not load the account from the environment. Got %+v", accounts)
+		}
+		if ynabSecret != dummyYnabSecret {
+			t.Errorf("Did not load the YNAB secret from the environment. Got %s want %s", ynabSecret, dummyYnabSecret)
+		}
+	})
+}
+
 func TestAuthorizedHandler(t *testing.T) {
 	t.Run("Hitting the authorization endpoint should hit the authorization handler", func(t *testing.T) {
 		setDummyConnector(true)
 		defer resetTestConnectorResponses()
-		responseRecorder := runDummyRequest(t, "GET", "/authorized", activeConnector.AuthorizedHandler)
+		responseRecorder := runDummyRequest(t, "GET", "/authorized", accounts[0].connector.AuthorizedHandler)
 		AssertStatus(t, http.StatusOK, responseRecorder.Code)
 		if AuthorizedHandlerWasHit != true {
 			t.Error("Oauth authorization handler was not hit")
@@ -230,19 +311,29 @@ func setDummyConnector(setActiveConnector bool) {
 	availableConnectors = []BankConnector{
 		testConnector{},
 	}
+	accounts = []*syncAccount{
+		{
+			Account: config.Account{
+				Name:          config.DefaultAccountName,
+				Number:        goodIban,
+				YNABBudgetID:  dummyYnabBudgetID,
+				YNABAccountID: dummyYnabAccountID,
+			},
+		},
+	}
 	if setActiveConnector {
-		activeConnector = testConnector{}
+		accounts[0].connector = testConnector{}
 	}
 }
 
 func resetTestConnectorResponses() {
 	AuthorizedHandlerWasHit = false
 	testConnectorAuthorizeResponse = "https://example.com/"
-	testConnectorCheckParamsError = nil
 	testConnectorIsValidAccountNumberResponse = true
 	testConnectorIsValidAccountNumberResponseError = nil
-	testConnectorGetTransactionsResponse = []ynabTransaction{}
+	testConnectorGetTransactionsResponse = []bank.Transaction{}
 	testConnectorGetTransactionsResponseError = nil
+	testConnectorGetTransactionsWindows = nil
 }
 
 func setRealConnectors(unsetActiveConnector bool) {
@@ -251,7 +342,7 @@ func setRealConnectors(unsetActiveConnector bool) {
 		dbapi.DbCreditConnector{},
 	}
 	if unsetActiveConnector {
-		activeConnector = nil
+		accounts = nil
 	}
 }
 
@@ -259,8 +350,8 @@ func setDummyTransactionResponse() {
 	date, _ := api.DateFromString("2020-05-05")
 	payeeName := string("payee-name")
 	importID := string("import-id")
-	testConnectorGetTransactionsResponse = []ynabTransaction{
-		{
+	testConnectorGetTransactionsResponse = []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{
 			AccountID: dummyYnabAccountID,
 			Date:      date,
 			Amount:    10000,
@@ -268,13 +359,15 @@ func setDummyTransactionResponse() {
 			Approved:  true,
 			PayeeName: &payeeName,
 			ImportID:  &importID,
-		},
+		}},
 	}
 }
 
 func setDummyYnabData() {
-	ynabAccountID = dummyYnabAccountID
-	ynabBudgetID = dummyYnabBudgetID
+	for _, account := range accounts {
+		account.YNABAccountID = dummyYnabAccountID
+		account.YNABBudgetID = dummyYnabBudgetID
+	}
 	ynabSecret = dummyYnabSecret
 }
 
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/rules"
+)
+
+// payeeRules rename payees before they are posted to YNAB, if a rules file is set.
+var payeeRules *rules.PayeeRules
+
+// loadRules loads the payee, category, approve and flag rules from the rules
+// file, if there is one.
+func loadRules(path string) error {
+	payeeRules, categoryRules, reviewRules = nil, nil, nil
+	if path == "" {
+		return nil
+	}
+	loaded, err := config.LoadRules(path)
+	if err != nil {
+		return err
+	}
+	payeeRules, err = rules.NewPayeeRules(loaded.Payees)
+	if err != nil {
+		return err
+	}
+	categoryRules, err = rules.NewCategoryRules(loaded.Categories)
+	if err != nil {
+		return err
+	}
+	reviewRules, err = rules.NewReviewRules(loaded.Approve, loaded.Flags)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d payee, %d category, %d approve and %d flag rules from %s", len(loaded.Payees), len(loaded.Categories), len(loaded.Approve), len(loaded.Flags), path)
+	return nil
+}
+
+// testRulesCommand shows which rule matches each payee given as an argument.
+func testRulesCommand(args []string) int {
+	flags := newFlagSet("test-rules")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: db-to-ynab test-rules [flags] <payee>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if payeeRules == nil {
+		log.Print("No rules file is set, set rules_file in the config file or RULES_FILE")
+		return exitUsage
+	}
+	exitCode := exitOK
+	for _, payee := range flags.Args() {
+		cleaned, rule := payeeRules.Match(payee)
+		if rule == nil {
+			fmt.Fprintf(output, "%q: no rule matched\n", payee)
+			exitCode = exitFailure
+			continue
+		}
+		fmt.Fprintf(output, "%q -> %q (%s)\n", payee, cleaned, describePayeeRule(rule))
+	}
+	return exitCode
+}
+
+// describePayeeRule returns the matcher of a rule and where it is defined.
+func describePayeeRule(rule *config.PayeeRule) string {
+	switch {
+	case rule.Exact != "":
+		return fmt.Sprintf("exact %q at %s", rule.Exact, rule.Source)
+	case rule.Prefix != "":
+		return fmt.Sprintf("prefix %q at %s", rule.Prefix, rule.Source)
+	}
+	return fmt.Sprintf("regex %q at %s", rule.Regex, rule.Source)
+}
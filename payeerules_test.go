@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTestRulesCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rulesFile := filepath.Join(dir, "rules.yaml")
+	ioutil.WriteFile(rulesFile, []byte("payees:\n  - prefix: REWE SAGT DANKE\n    payee: Rewe\n"), 0600)
+	configFile = ""
+	env := map[string]string{
+		"YNAB_SECRET":              dummyYnabSecret,
+		"DB_CLIENT_ID":             "client-id",
+		"DB_CLIENT_SECRET":         "client-secret",
+		"DB_API_ENDPOINT_HOSTNAME": "https://example.com/",
+		"REDIRECT_BASE_URL":        "http://localhost:3000/",
+		"DB_ACCOUNT":               goodIban,
+		"YNAB_BUDGET_ID":           dummyYnabBudgetID,
+		"YNAB_ACCOUNT_ID":          dummyYnabAccountID,
+		"RULES_FILE":               rulesFile,
+	}
+	for variable, value := range env {
+		os.Setenv(variable, value)
+		defer os.Unsetenv(variable)
+	}
+	defer func() { output = os.Stdout; payeeRules = nil }()
+	got := &bytes.Buffer{}
+	output = got
+	assertExitCode(t, exitFailure, runCommand([]string{"test-rules", "REWE SAGT DANKE 4431//Berlin/DE", "Rossmann"}))
+	expect := `"REWE SAGT DANKE 4431//Berlin/DE" -> "Rewe" (prefix "REWE SAGT DANKE" at ` + rulesFile + `:2)
+"Rossmann": no rule matched
+`
+	if got.String() != expect {
+		t.Errorf("Got wrong output. Got %q want %q", got.String(), expect)
+	}
+	assertExitCode(t, exitUsage, runCommand([]string{"test-rules"}))
+}
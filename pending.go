@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"go.bmvs.io/ynab/api/transaction"
+)
+
+// pendingBookingDays is how many days after its authorization a card
+// transaction may be booked.
+const pendingBookingDays int = 10
+
+// pendingAmountTolerance is how much, as a fraction of the pending amount, a
+// card transaction may change when it is booked, e.g. with a tip or a new
+// exchange rate.
+const pendingAmountTolerance float64 = 0.2
+
+// reconcilePending turns the pending transactions posted on earlier runs into
+// the booked transactions which replace them. A pending transaction in YNAB
+// which is no longer pending is matched with a transaction booked at most
+// pendingBookingDays later, see findBooking, and updated with its date,
+// amount, import ID and cleared status. Its payee, category and memo stay as
+// they are, in case they were edited in YNAB. The booked transaction is left
+// out, so the purchase is not in YNAB twice. A preview, for a dry run, does not
+// update YNAB but leaves out the same booked transactions as a sync.
+func reconcilePending(account *syncAccount, from time.Time, transactions []bank.Transaction, preview bool) []bank.Transaction {
+	existing, err := postedSince(account, from.AddDate(0, 0, -pendingBookingDays))
+	if err != nil {
+		log.Printf("Failed getting YNAB transactions, not reconciling pending transactions: %s", err)
+		return transactions
+	}
+	imported := make(map[string]bool)
+	for _, posted := range existing {
+		if posted.ImportID != nil {
+			imported[*posted.ImportID] = true
+		}
+	}
+	stillPending := make(map[string]bool)
+	for _, transaction := range transactions {
+		if transaction.Details.Pending {
+			stillPending[*transaction.ImportID] = true
+		}
+	}
+	replaced := make(map[int]bool)
+	for _, posted := range existing {
+		if posted.Deleted || posted.ImportID == nil || !strings.HasPrefix(*posted.ImportID, bank.PendingImportIDPrefix) || stillPending[*posted.ImportID] {
+			continue
+		}
+		booked := findBooking(posted, transactions, imported, replaced)
+		if booked < 0 {
+			log.Printf("Pending transaction of %s on %s is no longer pending and was not booked, delete it in YNAB if it was cancelled", formatMilliunits(posted.Amount), posted.Date.Format("2006-01-02"))
+			continue
+		}
+		update := keepYNABEdits(posted, transactions[booked].PayloadTransaction)
+		if preview {
+			log.Printf("Pending transaction of %s on %s was booked on %s, not updating it in a dry run", formatMilliunits(posted.Amount), posted.Date.Format("2006-01-02"), update.Date.Format("2006-01-02"))
+			replaced[booked] = true
+			continue
+		}
+		pendingAmount, pendingDate := formatMilliunits(posted.Amount), posted.Date.Format("2006-01-02")
+		if err := updatePosted(account, posted, update); err != nil {
+			log.Printf("Failed updating pending transaction %s, posting the booked one: %s", posted.ID, err)
+			continue
+		}
+		log.Printf("Updated pending transaction of %s on %s, it was booked on %s", pendingAmount, pendingDate, update.Date.Format("2006-01-02"))
+		replaced[booked] = true
+	}
+	kept := make([]bank.Transaction, 0, len(transactions))
+	for i, transaction := range transactions {
+		if !replaced[i] {
+			kept = append(kept, transaction)
+		}
+	}
+	return kept
+}
+
+// findBooking returns the index of the booked transaction which replaces a
+// pending one, or -1. The amount often changes when a card transaction is
+// booked, so it takes one of the same amount, or else one with the same payee,
+// or else one whose amount is within pendingAmountTolerance. Transactions
+// already in YNAB or replacing another pending transaction are skipped.
+func findBooking(pending *transaction.Transaction, transactions []bank.Transaction, imported map[string]bool, replaced map[int]bool) int {
+	latest := pending.Date.AddDate(0, 0, pendingBookingDays)
+	sameAmount, samePayee, closeAmount := -1, -1, -1
+	for i, booked := range transactions {
+		if booked.Details.Pending || replaced[i] || (booked.Amount < 0) != (pending.Amount < 0) {
+			continue
+		}
+		if booked.ImportID != nil && imported[*booked.ImportID] {
+			continue
+		}
+		if booked.Date.Before(pending.Date.Time) || booked.Date.After(latest) {
+			continue
+		}
+		switch {
+		case booked.Amount == pending.Amount:
+			if sameAmount < 0 {
+				sameAmount = i
+			}
+		case isSamePayee(pending.PayeeName, booked.PayeeName):
+			if samePayee < 0 {
+				samePayee = i
+			}
+		case math.Abs(float64(booked.Amount-pending.Amount)) <= math.Abs(float64(pending.Amount))*pendingAmountTolerance:
+			if closeAmount < 0 {
+				closeAmount = i
+			}
+		}
+	}
+	for _, i := range []int{sameAmount, samePayee, closeAmount} {
+		if i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// isSamePayee checks if two payees are the same, ignoring case, or one is
+// part of the other, as banks shorten payees differently.
+func isSamePayee(a *string, b *string) bool {
+	if a == nil || b == nil || *a == "" || *b == "" {
+		return false
+	}
+	lowerA, lowerB := strings.ToLower(*a), strings.ToLower(*b)
+	return strings.Contains(lowerA, lowerB) || strings.Contains(lowerB, lowerA)
+}
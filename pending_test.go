@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"go.bmvs.io/ynab/api"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestReconcilePending(t *testing.T) {
+	setDummyConnector(true)
+	setDummyYnabData()
+	defer gock.Off()
+	date := func(value string) api.Date {
+		parsed, _ := api.DateFromString(value)
+		return parsed
+	}
+	payee, bookedID, stillPendingID := "Marvel Comics Inc.", "5881cb1c0abd80695891732f39924704", bank.PendingImportIDPrefix+"0123456789abcdef0123456789ab"
+	transactions := []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{Date: date("2020-03-04"), Amount: -42210, PayeeName: &payee, Cleared: "cleared", ImportID: &bookedID}},
+		{PayloadTransaction: ynabTransaction{Date: date("2020-03-05"), Amount: -9990, PayeeName: &payee, Cleared: "uncleared", ImportID: &stillPendingID}, Details: bank.Details{Pending: true}},
+	}
+	gock.New("https://api.youneedabudget.com/").
+		Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+		MatchParam("since_date", "2020-02-20").
+		Reply(200).
+		BodyString(`{"data":{"transactions":[
+			{"id":"pending-id","date":"2020-03-02","amount":-42210,"cleared":"uncleared","approved":true,"payee_name":"Comics","memo":"Gift","import_id":"PENDING:5555cb1c0abd80695891732f3992"},
+			{"id":"still-pending-id","date":"2020-03-05","amount":-9990,"cleared":"uncleared","import_id":"` + stillPendingID + `"},
+			{"id":"cancelled-id","date":"2020-03-01","amount":-15000,"cleared":"uncleared","import_id":"PENDING:6666cb1c0abd80695891732f3992"}
+		]}}`)
+	gock.New("https://api.youneedabudget.com/").
+		Put("/v1/budgets/" + dummyYnabBudgetID + "/transactions/pending-id").
+		MatchType("json").
+		JSON(`{"transaction":{"account_id":"","date":"2020-03-04","amount":-42210,"cleared":"cleared","approved":true,"payee_id":null,"payee_name":"Comics","category_id":null,"memo":"Gift","flag_color":null,"import_id":"` + bookedID + `"}}`).
+		Reply(200).
+		BodyString(`{"data":{"transaction":{"id":"pending-id"}}}`)
+	testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+	testLogBuffer.ExpectLog("Updated pending transaction of -42.21 on 2020-03-02, it was booked on 2020-03-04")
+	testLogBuffer.ExpectLog("Pending transaction of -15.00 on 2020-03-01 is no longer pending and was not booked, delete it in YNAB if it was cancelled")
+	kept := reconcilePending(accounts[0], time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), transactions, false)
+	testLogBuffer.TestLogValues(t)
+	if !gock.IsDone() {
+		t.Error("Pending transaction was not updated in YNAB")
+	}
+	if len(kept) != 1 || !kept[0].Details.Pending {
+		t.Errorf("Booked transaction was not left out. Got %+v", kept)
+	}
+}
+
+func TestReconcilePendingPreview(t *testing.T) {
+	setDummyConnector(true)
+	setDummyYnabData()
+	defer gock.Off()
+	date, _ := api.DateFromString("2020-03-04")
+	payee, bookedID := "Marvel Comics Inc.", "5881cb1c0abd80695891732f39924704"
+	transactions := []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -42210, PayeeName: &payee, Cleared: "cleared", ImportID: &bookedID}},
+	}
+	gock.New("https://api.youneedabudget.com/").
+		Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+		MatchParam("since_date", "2020-02-20").
+		Reply(200).
+		BodyString(`{"data":{"transactions":[
+			{"id":"pending-id","date":"2020-03-02","amount":-42210,"cleared":"uncleared","import_id":"PENDING:5555cb1c0abd80695891732f3992"}
+		]}}`)
+	testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+	testLogBuffer.ExpectLog("Pending transaction of -42.21 on 2020-03-02 was booked on 2020-03-04, not updating it in a dry run")
+	kept := reconcilePending(accounts[0], time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), transactions, true)
+	testLogBuffer.TestLogValues(t)
+	if len(kept) != 0 {
+		t.Errorf("Booked transaction was not left out of the preview. Got %+v", kept)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("Preview changed YNAB")
+	}
+}
+
+func TestReconcilePendingChangedAmounts(t *testing.T) {
+	setDummyConnector(true)
+	setDummyYnabData()
+	defer gock.Off()
+	date, _ := api.DateFromString("2020-03-04")
+	fuel, cafe, shop, fuelID, cafeID, shopID := "SHELL TANKSTELLE 4431", "Cafe Luna", "Corner Shop", "fuel-import-id", "cafe-import-id", "shop-import-id"
+	transactions := []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -90000, PayeeName: &shop, Cleared: "cleared", ImportID: &shopID}},
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -38500, PayeeName: &fuel, Cleared: "cleared", ImportID: &fuelID}},
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -23000, PayeeName: &cafe, Cleared: "cleared", ImportID: &cafeID}},
+	}
+	gock.New("https://api.youneedabudget.com/").
+		Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+		MatchParam("since_date", "2020-02-20").
+		Reply(200).
+		BodyString(`{"data":{"transactions":[
+			{"id":"fuel-pending-id","date":"2020-03-02","amount":-150000,"cleared":"uncleared","payee_name":"Shell Tankstelle","import_id":"PENDING:1111cb1c0abd80695891732f3992"},
+			{"id":"cafe-pending-id","date":"2020-03-03","amount":-20000,"cleared":"uncleared","payee_name":"SQ *LUNA","import_id":"PENDING:2222cb1c0abd80695891732f3992"}
+		]}}`)
+	for _, update := range []struct{ id, amount, payee, importID string }{
+		{"fuel-pending-id", "-38500", "Shell Tankstelle", fuelID},
+		{"cafe-pending-id", "-23000", "SQ *LUNA", cafeID},
+	} {
+		gock.New("https://api.youneedabudget.com/").
+			Put("/v1/budgets/" + dummyYnabBudgetID + "/transactions/" + update.id).
+			MatchType("json").
+			JSON(`{"transaction":{"account_id":"","date":"2020-03-04","amount":` + update.amount + `,"cleared":"cleared","approved":false,"payee_id":null,"payee_name":"` + update.payee + `","category_id":null,"memo":null,"flag_color":null,"import_id":"` + update.importID + `"}}`).
+			Reply(200).
+			BodyString(`{"data":{"transaction":{"id":"` + update.id + `"}}}`)
+	}
+	testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+	testLogBuffer.ExpectLog("Updated pending transaction of -150.00 on 2020-03-02, it was booked on 2020-03-04")
+	testLogBuffer.ExpectLog("Updated pending transaction of -20.00 on 2020-03-03, it was booked on 2020-03-04")
+	kept := reconcilePending(accounts[0], time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), transactions, false)
+	testLogBuffer.TestLogValues(t)
+	if !gock.IsDone() {
+		t.Error("Pending transactions booked at another amount were not updated in YNAB")
+	}
+	if len(kept) != 1 || *kept[0].ImportID != shopID {
+		t.Errorf("Got wrong transactions left to post. Got %+v", kept)
+	}
+}
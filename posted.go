@@ -0,0 +1,130 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"go.bmvs.io/ynab"
+	"go.bmvs.io/ynab/api"
+	"go.bmvs.io/ynab/api/transaction"
+)
+
+// postedCache keeps the transactions of each YNAB account during a run, so
+// every stage of a sync reads them from one request per account instead of
+// asking YNAB again. Outside a run byAccount is nil, and every call asks YNAB.
+var postedCache = struct {
+	sync.Mutex
+	byAccount map[string]*postedWindow
+}{}
+
+// postedWindow is an account's transactions in YNAB dated since a day.
+type postedWindow struct {
+	since        string
+	transactions []*transaction.Transaction
+}
+
+// cachePostedTransactions starts keeping YNAB transactions at the start of a run.
+func cachePostedTransactions() {
+	postedCache.Lock()
+	defer postedCache.Unlock()
+	postedCache.byAccount = make(map[string]*postedWindow)
+}
+
+// forgetPostedTransactions stops keeping YNAB transactions at the end of a run.
+func forgetPostedTransactions() {
+	postedCache.Lock()
+	defer postedCache.Unlock()
+	postedCache.byAccount = nil
+}
+
+// postedSince returns an account's transactions in YNAB dated since a day.
+// During a run, the first call for an account gets them over the widest window
+// a stage of the run looks at, see postedFetchStart, and later calls reuse
+// them. A backfill goes forward in time, so its later chunks reuse them too.
+func postedSince(account *syncAccount, since time.Time) ([]*transaction.Transaction, error) {
+	day := since.Format(api.DateFormat)
+	postedCache.Lock()
+	defer postedCache.Unlock()
+	if postedCache.byAccount == nil {
+		return fetchPosted(account, day)
+	}
+	key := postedKey(account)
+	window, ok := postedCache.byAccount[key]
+	if !ok || window.since > day {
+		start := postedFetchStart(since).Format(api.DateFormat)
+		transactions, err := fetchPosted(account, start)
+		if err != nil {
+			return nil, err
+		}
+		window = &postedWindow{since: start, transactions: transactions}
+		postedCache.byAccount[key] = window
+	}
+	inWindow := make([]*transaction.Transaction, 0, len(window.transactions))
+	for _, posted := range window.transactions {
+		if posted.Date.Format(api.DateFormat) >= day {
+			inWindow = append(inWindow, posted)
+		}
+	}
+	return inWindow, nil
+}
+
+// rememberCreated adds the transactions a sync created in YNAB to the ones kept
+// for the run, so later chunks of a backfill know about them.
+func rememberCreated(account *syncAccount, created []*transaction.Transaction) {
+	postedCache.Lock()
+	defer postedCache.Unlock()
+	if window, ok := postedCache.byAccount[postedKey(account)]; ok {
+		window.transactions = append(window.transactions, created...)
+	}
+}
+
+// updatePosted updates a transaction in YNAB, and the copy kept for the run.
+func updatePosted(account *syncAccount, posted *transaction.Transaction, update ynabTransaction) error {
+	if _, err := ynab.NewClient(ynabSecret).Transaction().UpdateTransaction(account.YNABBudgetID, posted.ID, update); err != nil {
+		return err
+	}
+	postedCache.Lock()
+	defer postedCache.Unlock()
+	posted.Date, posted.Amount, posted.Cleared, posted.Approved = update.Date, update.Amount, update.Cleared, update.Approved
+	posted.PayeeName, posted.CategoryID, posted.Memo, posted.FlagColor, posted.ImportID = update.PayeeName, update.CategoryID, update.Memo, update.FlagColor, update.ImportID
+	return nil
+}
+
+// postedFetchStart is the first day of an account's transactions to get from
+// YNAB during a run, for a stage which looks at them since a day: the stages
+// looking furthest back are the categorizer's history and pending, transfer
+// and settlement matching.
+func postedFetchStart(since time.Time) time.Time {
+	margin := pendingBookingDays
+	for _, days := range []int{transferDays, settlementDays} {
+		if days > margin {
+			margin = days
+		}
+	}
+	start := since.AddDate(0, 0, -margin)
+	if categorizerSettings.Enabled {
+		if history := time.Now().AddDate(0, 0, -categorizerHistoryDays()); history.Before(start) {
+			start = history
+		}
+	}
+	return start
+}
+
+func fetchPosted(account *syncAccount, day string) ([]*transaction.Transaction, error) {
+	since, _ := api.DateFromString(day)
+	return ynab.NewClient(ynabSecret).Transaction().GetTransactionsByAccount(account.YNABBudgetID, account.YNABAccountID, &transaction.Filter{Since: &since})
+}
+
+func postedKey(account *syncAccount) string {
+	return account.YNABBudgetID + "/" + account.YNABAccountID
+}
+
+// categorizerHistoryDays is how many days of YNAB transactions the
+// categorizer learns from.
+func categorizerHistoryDays() int {
+	if categorizerSettings.HistoryDays == 0 {
+		return config.DefaultHistoryDays
+	}
+	return categorizerSettings.HistoryDays
+}
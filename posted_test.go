@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.bmvs.io/ynab/api/transaction"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestPostedSince(t *testing.T) {
+	setDummyConnector(true)
+	setDummyYnabData()
+	defer gock.Off()
+	from := time.Date(2020, 3, 11, 0, 0, 0, 0, time.UTC)
+	mockYNABTransactions := func(since string) {
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+			MatchParam("since_date", since).
+			Times(1).
+			Reply(200).
+			BodyString(`{"data":{"transactions":[
+				{"id":"old-id","date":"2020-03-02","amount":-1000,"cleared":"cleared","import_id":"old-import-id"},
+				{"id":"new-id","date":"2020-03-12","amount":-2000,"cleared":"cleared","import_id":"new-import-id"}
+			]}}`)
+	}
+	t.Run("A run fetches each account once, over the widest window", func(t *testing.T) {
+		cachePostedTransactions()
+		defer forgetPostedTransactions()
+		mockYNABTransactions("2020-03-01")
+		for _, since := range []time.Time{from, from.AddDate(0, 0, -transferDays), from.AddDate(0, 0, -pendingBookingDays), from.AddDate(0, 0, 5)} {
+			if _, err := postedSince(accounts[0], since); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !gock.IsDone() || gock.HasUnmatchedRequest() {
+			t.Error("YNAB transactions were not fetched exactly once")
+		}
+		posted, _ := postedSince(accounts[0], from)
+		if len(posted) != 1 || posted[0].ID != "new-id" {
+			t.Errorf("Got transactions from before the window. Got %+v", posted)
+		}
+		rememberCreated(accounts[0], []*transaction.Transaction{{ID: "created-id", Date: posted[0].Date}})
+		if posted, _ := postedSince(accounts[0], from); len(posted) != 2 {
+			t.Errorf("Created transaction was not kept for the run. Got %+v", posted)
+		}
+	})
+	t.Run("Outside a run every call fetches", func(t *testing.T) {
+		mockYNABTransactions("2020-03-11")
+		mockYNABTransactions("2020-03-11")
+		postedSince(accounts[0], from)
+		postedSince(accounts[0], from)
+		if !gock.IsDone() {
+			t.Error("YNAB transactions were kept outside a run")
+		}
+	})
+}
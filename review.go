@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/rules"
+	"go.bmvs.io/ynab"
+)
+
+// reviewRules approve and flag transactions, if a rules file is set.
+var reviewRules *rules.ReviewRules
+
+// knownPayees caches the known payees of each budget during a run, so they are
+// fetched once per run rather than for every account.
+var knownPayees = struct {
+	sync.Mutex
+	byBudget map[string]rules.KnownPayees
+}{}
+
+// forgetKnownPayees clears the cached known payees at the start of a run.
+func forgetKnownPayees() {
+	knownPayees.Lock()
+	defer knownPayees.Unlock()
+	knownPayees.byBudget = nil
+}
+
+// knownPayeesFor returns the payees of the budget, if a rule has a new_payee
+// condition. If they cannot be fetched, all payees count as known, so nothing
+// is flagged as new by mistake.
+func knownPayeesFor(account *syncAccount, transactions []bank.Transaction) rules.KnownPayees {
+	needed := (categoryRules != nil && categoryRules.NeedsPayees()) || (reviewRules != nil && reviewRules.NeedsPayees())
+	if !needed || len(transactions) == 0 {
+		return nil
+	}
+	knownPayees.Lock()
+	defer knownPayees.Unlock()
+	if payees, ok := knownPayees.byBudget[account.YNABBudgetID]; ok {
+		return payees
+	}
+	if knownPayees.byBudget == nil {
+		knownPayees.byBudget = make(map[string]rules.KnownPayees)
+	}
+	payees := fetchKnownPayees(account.YNABBudgetID)
+	knownPayees.byBudget[account.YNABBudgetID] = payees
+	return payees
+}
+
+// fetchKnownPayees gets the payees of a budget from YNAB. Transfer payees
+// are left out, they are accounts rather than payees.
+func fetchKnownPayees(budgetID string) rules.KnownPayees {
+	snapshot, err := ynab.NewClient(ynabSecret).Payee().GetPayees(budgetID, nil)
+	if err != nil {
+		log.Printf("Failed getting YNAB payees, no payee counts as new: %s", err)
+		return nil
+	}
+	payees := make(map[string]bool)
+	for _, payee := range snapshot.Payees {
+		if !payee.Deleted && payee.TransferAccountID == nil {
+			payees[strings.ToLower(payee.Name)] = true
+		}
+	}
+	return func(payee string) bool {
+		return payees[strings.ToLower(payee)]
+	}
+}
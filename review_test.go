@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/rules"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestGetTransactionsReview(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	setDummyYnabData()
+	defer func() { reviewRules = nil }()
+	yes := true
+	reviewRules, _ = rules.NewReviewRules(
+		[]config.ApproveRule{{Conditions: config.Conditions{Payee: "^landlord$"}}},
+		[]config.FlagRule{{Color: "orange", Conditions: config.Conditions{NewPayee: &yes}}},
+	)
+	setTransactions := func() {
+		landlord, shop := "Landlord", "Corner Shop"
+		testConnectorGetTransactionsResponse = []bank.Transaction{
+			{PayloadTransaction: ynabTransaction{PayeeName: &landlord}},
+			{PayloadTransaction: ynabTransaction{PayeeName: &shop}},
+		}
+	}
+	t.Run("Payees missing from the budget are new", func(t *testing.T) {
+		defer gock.Off()
+		forgetKnownPayees()
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/payees").
+			Reply(200).
+			BodyString(`{"data":{"payees":[{"id":"1","name":"LANDLORD","deleted":false},{"id":"2","name":"Corner Shop","deleted":true},{"id":"3","name":"Transfer : Corner Shop","transfer_account_id":"shop-account-id","deleted":false}]}}`)
+		setTransactions()
+		transactions, _ := getTransactions(accounts[0], time.Now(), time.Now())
+		if !transactions[0].Approved || transactions[0].FlagColor != nil {
+			t.Errorf("Known payee got wrong review. Got approved %t, flag %v", transactions[0].Approved, transactions[0].FlagColor)
+		}
+		if transactions[1].Approved || transactions[1].FlagColor == nil || *transactions[1].FlagColor != "orange" {
+			t.Errorf("New payee got wrong review. Got approved %t, flag %v", transactions[1].Approved, transactions[1].FlagColor)
+		}
+	})
+	t.Run("Without YNAB payees nothing is new", func(t *testing.T) {
+		defer gock.Off()
+		forgetKnownPayees()
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/payees").
+			Reply(500)
+		setTransactions()
+		transactions, _ := getTransactions(accounts[0], time.Now(), time.Now())
+		if transactions[1].FlagColor != nil {
+			t.Errorf("Payee was flagged as new without YNAB payees: %s", *transactions[1].FlagColor)
+		}
+	})
+	t.Run("Payees are fetched once per run", func(t *testing.T) {
+		defer gock.Off()
+		forgetKnownPayees()
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/payees").
+			Times(1).
+			Reply(200).
+			BodyString(`{"data":{"payees":[{"id":"1","name":"Landlord","deleted":false}]}}`)
+		setTransactions()
+		getTransactions(accounts[0], time.Now(), time.Now())
+		transactions, _ := getTransactions(accounts[0], time.Now(), time.Now())
+		if transactions[0].FlagColor != nil || transactions[1].FlagColor == nil {
+			t.Errorf("Second account of the run got wrong flags. Got %v and %v", transactions[0].FlagColor, transactions[1].FlagColor)
+		}
+		if !gock.IsDone() || gock.HasUnmatchedRequest() {
+			t.Error("Payees were not fetched exactly once")
+		}
+	})
+}
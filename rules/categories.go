@@ -0,0 +1,46 @@
+package rules
+
+import (
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+)
+
+// CategoryRules choose the category of transactions.
+type CategoryRules struct {
+	rules      []config.CategoryRule
+	conditions []conditions
+}
+
+// NewCategoryRules compiles category rules.
+func NewCategoryRules(rules []config.CategoryRule) (*CategoryRules, error) {
+	categoryRules := &CategoryRules{rules: rules}
+	for _, rule := range rules {
+		compiled, err := compileConditions(rule.Conditions)
+		if err != nil {
+			return nil, err
+		}
+		categoryRules.conditions = append(categoryRules.conditions, compiled)
+	}
+	return categoryRules, nil
+}
+
+// Rules returns the rules, in the order they are tried.
+func (c *CategoryRules) Rules() []config.CategoryRule {
+	return c.rules
+}
+
+// NeedsPayees checks if any rule has a new_payee condition, which needs the
+// known payees of the budget.
+func (c *CategoryRules) NeedsPayees() bool {
+	return needsPayees(c.conditions)
+}
+
+// Match returns the first rule which matches a transaction, or nil.
+func (c *CategoryRules) Match(transaction bank.Transaction, knownPayees KnownPayees) *config.CategoryRule {
+	for i := range c.rules {
+		if c.conditions[i].matches(transaction, knownPayees) {
+			return &c.rules[i]
+		}
+	}
+	return nil
+}
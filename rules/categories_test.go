@@ -0,0 +1,54 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+)
+
+func TestCategoryRulesMatch(t *testing.T) {
+	min, max := -100.0, -10.5
+	categoryRules, err := NewCategoryRules([]config.CategoryRule{
+		{Category: "Rent", Conditions: config.Conditions{IBAN: "DE89 3704 0044 0532 0130 00"}},
+		{Category: "Insurance", Conditions: config.Conditions{CreditorID: "DE0222200004544221"}},
+		{Category: "Groceries", Conditions: config.Conditions{Payee: "^rewe", MinAmount: &min, MaxAmount: &max}},
+		{Category: "Snacks", Conditions: config.Conditions{Payee: "^rewe"}},
+		{Category: "Fees", Conditions: config.Conditions{Memo: "entgelt", Kind: bank.KindDirectDebit}},
+		{Category: "Cash", Conditions: config.Conditions{FamilyCode: "ccrd", SubFamilyCode: "CWDL"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTransaction := func(payee string, memo string, amount int64, details bank.Details) bank.Transaction {
+		transaction := bank.Transaction{Details: details}
+		transaction.PayeeName = &payee
+		transaction.Memo = &memo
+		transaction.Amount = amount
+		return transaction
+	}
+	for _, test := range []struct {
+		name        string
+		transaction bank.Transaction
+		expect      string
+	}{
+		{"IBANs ignore spaces", newTransaction("Landlord", "", -950000, bank.Details{CounterPartyIBAN: "DE89370400440532013000"}), "Rent"},
+		{"Creditor IDs match", newTransaction("Allianz", "", -25000, bank.Details{CreditorID: "DE0222200004544221"}), "Insurance"},
+		{"Amount ranges include their limits", newTransaction("REWE SAGT DANKE", "", -10500, bank.Details{}), "Groceries"},
+		{"Amounts out of range fall through", newTransaction("Rewe", "", -3500, bank.Details{}), "Snacks"},
+		{"All conditions must match", newTransaction("DB", "Kontoentgelt", -4990, bank.Details{}), ""},
+		{"Kinds come from the bank details", newTransaction("DB", "Kontoentgelt", -4990, bank.Details{CreditorID: "DE98ZZZ09999999999"}), "Fees"},
+		{"Transaction codes ignore case", newTransaction("", "", -50000, bank.Details{FamilyCode: "CCRD", SubFamilyCode: "CWDL"}), "Cash"},
+		{"Nothing matches", newTransaction("Rossmann", "", -1999, bank.Details{}), ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			if rule := categoryRules.Match(test.transaction, nil); rule != nil {
+				got = rule.Category
+			}
+			if got != test.expect {
+				t.Errorf("Got wrong category. Got %q want %q", got, test.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package rules
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+)
+
+// KnownPayees checks if a payee already appears in the budget. Without it, all
+// payees count as known.
+type KnownPayees func(payee string) bool
+
+// conditions are config.Conditions with the patterns compiled and the amounts
+// in milliunits.
+type conditions struct {
+	config.Conditions
+	payee     *regexp.Regexp
+	memo      *regexp.Regexp
+	minAmount *int64
+	maxAmount *int64
+}
+
+func compileConditions(source config.Conditions) (conditions, error) {
+	compiled := conditions{Conditions: source}
+	var err error
+	if compiled.payee, err = compilePattern(source.Payee); err != nil {
+		return compiled, err
+	}
+	if compiled.memo, err = compilePattern(source.Memo); err != nil {
+		return compiled, err
+	}
+	if compiled.minAmount, err = milliunits(source.MinAmount); err != nil {
+		return compiled, err
+	}
+	compiled.maxAmount, err = milliunits(source.MaxAmount)
+	return compiled, err
+}
+
+func (c conditions) matches(transaction bank.Transaction, knownPayees KnownPayees) bool {
+	details := transaction.Details
+	if c.payee != nil && (transaction.PayeeName == nil || !c.payee.MatchString(*transaction.PayeeName)) {
+		return false
+	}
+	if c.memo != nil && (transaction.Memo == nil || !c.memo.MatchString(*transaction.Memo)) {
+		return false
+	}
+	if c.minAmount != nil && transaction.Amount < *c.minAmount {
+		return false
+	}
+	if c.maxAmount != nil && transaction.Amount > *c.maxAmount {
+		return false
+	}
+	if c.IBAN != "" && tools.NormalizeIBAN(c.IBAN) != tools.NormalizeIBAN(details.CounterPartyIBAN) {
+		return false
+	}
+	if c.Kind != "" && c.Kind != details.Kind() {
+		return false
+	}
+	if c.NewPayee != nil && *c.NewPayee != isNewPayee(transaction, knownPayees) {
+		return false
+	}
+	if c.ForeignCurrency != nil && *c.ForeignCurrency != details.IsForeignCurrency() {
+		return false
+	}
+	for _, code := range []struct {
+		expect string
+		got    string
+	}{
+		{c.CreditorID, details.CreditorID},
+		{c.TransactionCode, details.TransactionCode},
+		{c.DomainCode, details.DomainCode},
+		{c.FamilyCode, details.FamilyCode},
+		{c.SubFamilyCode, details.SubFamilyCode},
+	} {
+		if code.expect != "" && !strings.EqualFold(code.expect, code.got) {
+			return false
+		}
+	}
+	return true
+}
+
+func needsPayees(rules []conditions) bool {
+	for _, rule := range rules {
+		if rule.NewPayee != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isNewPayee(transaction bank.Transaction, knownPayees KnownPayees) bool {
+	if knownPayees == nil || transaction.PayeeName == nil {
+		return false
+	}
+	return !knownPayees(*transaction.PayeeName)
+}
+
+// compilePattern compiles a pattern which ignores case, or returns nil for an
+// empty pattern.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+func milliunits(amount *float64) (*int64, error) {
+	if amount == nil {
+		return nil, nil
+	}
+	converted, err := tools.ConvertToMilliunits(strconv.FormatFloat(*amount, 'f', -1, 64))
+	if err != nil {
+		return nil, err
+	}
+	return &converted, nil
+}
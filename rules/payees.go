@@ -0,0 +1,66 @@
+// Package rules applies the rules from the rules file to transactions.
+package rules
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+)
+
+// PayeeRules map payee names from the bank to clean names.
+type PayeeRules struct {
+	rules   []config.PayeeRule
+	regexes []*regexp.Regexp
+}
+
+// NewPayeeRules compiles payee rules.
+func NewPayeeRules(rules []config.PayeeRule) (*PayeeRules, error) {
+	payeeRules := &PayeeRules{rules: rules, regexes: make([]*regexp.Regexp, len(rules))}
+	for i, rule := range rules {
+		if rule.Regex == "" {
+			continue
+		}
+		regex, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return nil, err
+		}
+		payeeRules.regexes[i] = regex
+	}
+	return payeeRules, nil
+}
+
+// Match returns the clean name for a payee, and the rule which matched. If no
+// rule matches, it returns the payee unchanged and nil.
+func (p *PayeeRules) Match(payee string) (string, *config.PayeeRule) {
+	for i, rule := range p.rules {
+		switch {
+		case rule.Exact != "" && strings.EqualFold(payee, rule.Exact):
+			return rule.Payee, &p.rules[i]
+		case rule.Prefix != "" && len(payee) >= len(rule.Prefix) && strings.EqualFold(payee[:len(rule.Prefix)], rule.Prefix):
+			return rule.Payee, &p.rules[i]
+		case p.regexes[i] != nil:
+			if match := p.regexes[i].FindStringSubmatchIndex(payee); match != nil {
+				return string(p.regexes[i].ExpandString(nil, rule.Payee, payee, match)), &p.rules[i]
+			}
+		}
+	}
+	return payee, nil
+}
+
+// Apply renames the payees of transactions which match a rule.
+func (p *PayeeRules) Apply(transactions []bank.Transaction) {
+	for i, transaction := range transactions {
+		if transaction.PayeeName == nil {
+			continue
+		}
+		payee, rule := p.Match(*transaction.PayeeName)
+		if rule == nil {
+			continue
+		}
+		payee = tools.NormalizeText(payee, bank.MaxPayeeLength)
+		transactions[i].PayeeName = &payee
+	}
+}
@@ -0,0 +1,64 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+)
+
+var testPayeeRules = []config.PayeeRule{
+	{Exact: "PAYPAL", Payee: "PayPal", Source: "rules.yaml:2"},
+	{Prefix: "REWE SAGT DANKE", Payee: "Rewe", Source: "rules.yaml:4"},
+	{Regex: `^AMZN MKTP (\w+)`, Payee: "Amazon $1", Source: "rules.yaml:6"},
+	{Prefix: "REWE", Payee: "Rewe Markt", Source: "rules.yaml:8"},
+}
+
+func TestPayeeRulesMatch(t *testing.T) {
+	payeeRules, err := NewPayeeRules(testPayeeRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name   string
+		payee  string
+		expect string
+		source string
+	}{
+		{"Exact matches ignore case", "PayPal", "PayPal", "rules.yaml:2"},
+		{"Exact matches need the whole name", "PAYPAL EUROPE", "PAYPAL EUROPE", ""},
+		{"Prefix matches ignore case", "Rewe sagt danke 4431//Berlin/DE", "Rewe", "rules.yaml:4"},
+		{"Regex matches expand groups", "AMZN MKTP DE*2K4L83", "Amazon DE", "rules.yaml:6"},
+		{"The first matching rule applies", "REWE Markt GmbH", "Rewe Markt", "rules.yaml:8"},
+		{"Unmatched payees are unchanged", "Rossmann", "Rossmann", ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, rule := payeeRules.Match(test.payee)
+			if got != test.expect {
+				t.Errorf("Got wrong payee. Got %q want %q", got, test.expect)
+			}
+			source := ""
+			if rule != nil {
+				source = rule.Source
+			}
+			if source != test.source {
+				t.Errorf("Got wrong rule. Got %q want %q", source, test.source)
+			}
+		})
+	}
+}
+
+func TestPayeeRulesApply(t *testing.T) {
+	payeeRules, _ := NewPayeeRules(testPayeeRules)
+	rewe, rossmann := "REWE SAGT DANKE 4431//Berlin/DE", "Rossmann"
+	transactions := make([]bank.Transaction, 3)
+	transactions[0].PayeeName = &rewe
+	transactions[1].PayeeName = &rossmann
+	payeeRules.Apply(transactions)
+	if *transactions[0].PayeeName != "Rewe" || *transactions[1].PayeeName != "Rossmann" || transactions[2].PayeeName != nil {
+		t.Errorf("Got wrong payees: %v, %v, %v", *transactions[0].PayeeName, *transactions[1].PayeeName, transactions[2].PayeeName)
+	}
+	if rewe != "REWE SAGT DANKE 4431//Berlin/DE" {
+		t.Errorf("Applying rules changed the connector's payee: %s", rewe)
+	}
+}
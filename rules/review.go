@@ -0,0 +1,61 @@
+package rules
+
+import (
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"go.bmvs.io/ynab/api/transaction"
+)
+
+// ReviewRules approve and flag transactions, so only the ones which need a look
+// are left to review in YNAB.
+type ReviewRules struct {
+	approve []conditions
+	flags   []config.FlagRule
+	flagIf  []conditions
+}
+
+// NewReviewRules compiles approve and flag rules.
+func NewReviewRules(approve []config.ApproveRule, flags []config.FlagRule) (*ReviewRules, error) {
+	reviewRules := &ReviewRules{flags: flags}
+	for _, rule := range approve {
+		compiled, err := compileConditions(rule.Conditions)
+		if err != nil {
+			return nil, err
+		}
+		reviewRules.approve = append(reviewRules.approve, compiled)
+	}
+	for _, rule := range flags {
+		compiled, err := compileConditions(rule.Conditions)
+		if err != nil {
+			return nil, err
+		}
+		reviewRules.flagIf = append(reviewRules.flagIf, compiled)
+	}
+	return reviewRules, nil
+}
+
+// NeedsPayees checks if any rule has a new_payee condition, which needs the
+// known payees of the budget.
+func (r *ReviewRules) NeedsPayees() bool {
+	return needsPayees(r.approve) || needsPayees(r.flagIf)
+}
+
+// Apply approves transactions which match an approve rule, and sets the flag
+// color of the first matching flag rule.
+func (r *ReviewRules) Apply(transactions []bank.Transaction, knownPayees KnownPayees) {
+	for i := range transactions {
+		for _, rule := range r.approve {
+			if rule.matches(transactions[i], knownPayees) {
+				transactions[i].Approved = true
+				break
+			}
+		}
+		for j, rule := range r.flagIf {
+			if rule.matches(transactions[i], knownPayees) {
+				color := transaction.FlagColor(r.flags[j].Color)
+				transactions[i].FlagColor = &color
+				break
+			}
+		}
+	}
+}
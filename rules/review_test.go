@@ -0,0 +1,62 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+)
+
+func TestReviewRulesApply(t *testing.T) {
+	yes, large := true, -500.0
+	reviewRules, err := NewReviewRules(
+		[]config.ApproveRule{
+			{Conditions: config.Conditions{IBAN: "DE89370400440532013000"}},
+			{Conditions: config.Conditions{Payee: "^employer gmbh$", MinAmount: &large}},
+		},
+		[]config.FlagRule{
+			{Color: "red", Conditions: config.Conditions{MaxAmount: &large}},
+			{Color: "orange", Conditions: config.Conditions{NewPayee: &yes}},
+			{Color: "blue", Conditions: config.Conditions{ForeignCurrency: &yes}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reviewRules.NeedsPayees() {
+		t.Error("Rules with a new_payee condition do not need payees")
+	}
+	newTransaction := func(payee string, amount int64, details bank.Details) bank.Transaction {
+		transaction := bank.Transaction{Details: details}
+		transaction.PayeeName = &payee
+		transaction.Amount = amount
+		return transaction
+	}
+	transactions := []bank.Transaction{
+		newTransaction("Landlord", -950000, bank.Details{CounterPartyIBAN: "DE89370400440532013000"}),
+		newTransaction("Employer GmbH", 3200000, bank.Details{}),
+		newTransaction("Rewe", -23500, bank.Details{}),
+		newTransaction("Corner Shop", -3500, bank.Details{}),
+		newTransaction("Rewe", -4000, bank.Details{CurrencyCode: "EUR", ForeignCurrency: "USD"}),
+	}
+	known := map[string]bool{"Landlord": true, "Employer GmbH": true, "Rewe": true}
+	reviewRules.Apply(transactions, func(payee string) bool { return known[payee] })
+	for i, expect := range []struct {
+		approved bool
+		flag     string
+	}{
+		{true, "red"},
+		{true, ""},
+		{false, ""},
+		{false, "orange"},
+		{false, "blue"},
+	} {
+		flag := ""
+		if transactions[i].FlagColor != nil {
+			flag = string(*transactions[i].FlagColor)
+		}
+		if transactions[i].Approved != expect.approved || flag != expect.flag {
+			t.Errorf("Got wrong review for transaction %d. Got approved %t, flag %q want %t, %q", i, transactions[i].Approved, flag, expect.approved, expect.flag)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/robfig/cron/v3"
+)
+
+// intervalSchedule runs at a fixed interval after each run.
+type intervalSchedule time.Duration
+
+// Next returns the time one interval after t.
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// scheduler syncs all accounts on a schedule, with an optional random delay
+// before each run.
+type scheduler struct {
+	schedule cron.Schedule
+	jitter   time.Duration
+	sync     func()
+
+	mu      sync.Mutex
+	nextRun time.Time
+	stop    chan struct{}
+}
+
+// newScheduler returns a scheduler for the configured schedule, or nil if no
+// schedule is configured.
+func newScheduler(settings config.Schedule, syncFunc func()) (*scheduler, error) {
+	var schedule cron.Schedule
+	switch {
+	case settings.Cron != "":
+		cronSchedule, err := cron.ParseStandard(settings.Cron)
+		if err != nil {
+			return nil, err
+		}
+		schedule = cronSchedule
+	case settings.Interval != "":
+		interval, err := time.ParseDuration(settings.Interval)
+		if err != nil {
+			return nil, err
+		}
+		schedule = intervalSchedule(interval)
+	default:
+		return nil, nil
+	}
+	var jitter time.Duration
+	if settings.Jitter != "" {
+		var err error
+		if jitter, err = time.ParseDuration(settings.Jitter); err != nil {
+			return nil, err
+		}
+	}
+	return &scheduler{schedule: schedule, jitter: jitter, sync: syncFunc}, nil
+}
+
+// Start runs syncs in the background until Stop is called.
+func (s *scheduler) Start() {
+	s.mu.Lock()
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+	next := s.scheduleNext(time.Now())
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				s.sync()
+				next = s.scheduleNext(time.Now())
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops scheduling syncs. A sync which is already running is not interrupted.
+func (s *scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// NextRun returns the time of the next scheduled sync, or zero if the scheduler is not running.
+func (s *scheduler) NextRun() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		return time.Time{}
+	}
+	return s.nextRun
+}
+
+// scheduleNext calculates and records the next run after now.
+func (s *scheduler) scheduleNext(now time.Time) time.Time {
+	next := s.schedule.Next(now)
+	if s.jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextRun = next
+	return next
+}
+
+// scheduledSync syncs all accounts, unless we are not authorized yet or a sync
+// is already running.
+func scheduledSync() {
+	log.Print("Starting scheduled sync")
+	if authorizeURL(accounts) != "" {
+		log.Print("We are not yet authorized, skipping scheduled sync. Visit this application in a browser to log in")
+		return
+	}
+	if dryRun {
+		results, _ := dryRunAccounts(accounts, nil)
+		renderDryRunTable(log.Writer(), results)
+		return
+	}
+	if err := runSync(accounts); err == errSyncInProgress {
+		log.Print("Previous sync is still running, skipping scheduled sync")
+	}
+}
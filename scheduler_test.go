@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+)
+
+func TestNewScheduler(t *testing.T) {
+	now := time.Date(2020, 5, 5, 8, 30, 0, 0, time.Local)
+	t.Run("No schedule returns no scheduler", func(t *testing.T) {
+		s, err := newScheduler(config.Schedule{}, scheduledSync)
+		if s != nil || err != nil {
+			t.Errorf("Got a scheduler without a schedule: %v, %v", s, err)
+		}
+	})
+	t.Run("Cron expressions run at the next matching time", func(t *testing.T) {
+		s, err := newScheduler(config.Schedule{Cron: "0 7,19 * * *"}, scheduledSync)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertNextRun(t, s.scheduleNext(now), time.Date(2020, 5, 5, 19, 0, 0, 0, time.Local))
+	})
+	t.Run("Intervals run one interval later", func(t *testing.T) {
+		s, err := newScheduler(config.Schedule{Interval: "12h"}, scheduledSync)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertNextRun(t, s.scheduleNext(now), now.Add(12*time.Hour))
+	})
+	t.Run("Jitter delays runs by up to the jitter", func(t *testing.T) {
+		s, err := newScheduler(config.Schedule{Interval: "1h", Jitter: "10m"}, scheduledSync)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			next := s.scheduleNext(now)
+			if next.Before(now.Add(time.Hour)) || !next.Before(now.Add(time.Hour+10*time.Minute)) {
+				t.Fatalf("Next run is outside the jitter window: %s", next)
+			}
+		}
+	})
+	t.Run("Invalid schedules return an error", func(t *testing.T) {
+		if _, err := newScheduler(config.Schedule{Cron: "every day"}, scheduledSync); err == nil {
+			t.Error("Invalid cron expression did not return an error")
+		}
+	})
+}
+
+func TestSchedulerRunsSyncs(t *testing.T) {
+	runs := make(chan bool, 10)
+	s, _ := newScheduler(config.Schedule{Interval: "10ms"}, func() { runs <- true })
+	s.Start()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("Scheduler did not run a sync")
+		}
+	}
+	s.Stop()
+	if !s.NextRun().IsZero() {
+		t.Errorf("Stopped scheduler still has a next run: %s", s.NextRun())
+	}
+}
+
+func TestScheduledSync(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	t.Run("Scheduled syncs wait for authorization", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Starting scheduled sync")
+		testLogBuffer.ExpectLog("We are not yet authorized, skipping scheduled sync. Visit this application in a browser to log in")
+		scheduledSync()
+		testLogBuffer.TestLogValues(t)
+	})
+	testConnectorAuthorizeResponse = ""
+	setDummyYnabData()
+	t.Run("Scheduled syncs sync all accounts", func(t *testing.T) {
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Starting scheduled sync")
+		testLogBuffer.ExpectLog("Syncing account default")
+		testLogBuffer.ExpectLog("Received 0 transactions from bank")
+		testLogBuffer.ExpectLog("Ending run")
+		scheduledSync()
+		testLogBuffer.TestLogValues(t)
+	})
+	t.Run("Scheduled syncs skip while a sync is running", func(t *testing.T) {
+		syncState.begin()
+		defer syncState.end(nil)
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Starting scheduled sync")
+		testLogBuffer.ExpectLog("Previous sync is still running, skipping scheduled sync")
+		scheduledSync()
+		testLogBuffer.TestLogValues(t)
+	})
+}
+
+func assertNextRun(t *testing.T, got time.Time, expect time.Time) {
+	if !got.Equal(expect) {
+		t.Errorf("Got wrong next run. Got %s want %s", got, expect)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/dbapi"
+	"go.bmvs.io/ynab/api/transaction"
+)
+
+// settlementDays is how many days apart the two sides of a card settlement may
+// be booked.
+var settlementDays int = config.DefaultSettlementDays
+
+// settlementReference matches the counterparty, payment reference or creditor
+// ID of the cash side of a card settlement, so other debits of the same amount
+// as a card refund are not taken for one.
+var settlementReference = regexp.MustCompile(config.DefaultSettlementReference)
+
+// linkSettlements turns credit card settlements into YNAB transfers. DB books a
+// settlement twice, as a debit on the cash account and as a credit of the same
+// amount on the card account, a few days apart. When both accounts are
+// configured in the same budget, the debit is posted as a transfer to the card
+// account, and the credit is left out because YNAB creates it with the
+// transfer. That only happens while the two sides are linked, see isLinked, so
+// a side booked and posted before the other one stays a regular transaction and
+// the other side is posted as one too. The other account's transactions are
+// fetched from the bank to find the matching side.
+func linkSettlements(account *syncAccount, from time.Time, to time.Time, transactions []bank.Transaction) []bank.Transaction {
+	isCard := isCardAccount(account)
+	leftOut := make(map[int]bool)
+	for _, partner := range settlementPartners(account) {
+		partnerTransactions, err := partner.connector.GetTransactions(partner.Account, from.AddDate(0, 0, -settlementDays), to.AddDate(0, 0, settlementDays))
+		if err != nil {
+			log.Printf("Failed getting transactions of account %s, not linking card settlements with it: %s", partner.Name, err)
+			continue
+		}
+		if partner.ImportIDFormat == config.ImportIDFormatYNAB {
+			setYNABImportIDs(partnerTransactions)
+		}
+		cash, card, cashAccount, cardAccount := transactions, partnerTransactions, account, partner
+		if isCard {
+			cash, card, cashAccount, cardAccount = partnerTransactions, transactions, partner, account
+		}
+		cashLegs, cashLegIndexes := settlementLegs(cash, isSettlementDebit)
+		cardLegs, cardLegIndexes := settlementLegs(card, func(bank.Transaction) bool { return true })
+		legMatches := matchLegs(cashLegs, cardLegs, settlementDays)
+		if len(legMatches) == 0 {
+			continue
+		}
+		matches := make(map[int]int, len(legMatches))
+		for cashLeg, cardLeg := range legMatches {
+			matches[cashLegIndexes[cashLeg]] = cardLegIndexes[cardLeg]
+		}
+		cashPosted, err := postedByImportID(cashAccount, from.AddDate(0, 0, -settlementDays))
+		var cardPosted map[string]*transaction.Transaction
+		if err == nil {
+			cardPosted, err = postedByImportID(cardAccount, from.AddDate(0, 0, -settlementDays))
+		}
+		cashIndexes := make([]int, 0, len(matches))
+		for cashIndex := range matches {
+			cashIndexes = append(cashIndexes, cashIndex)
+		}
+		sort.Ints(cashIndexes)
+		for _, cashIndex := range cashIndexes {
+			cardIndex := matches[cashIndex]
+			own := cashIndex
+			if isCard {
+				own = cardIndex
+			}
+			if err != nil {
+				log.Printf("Failed checking settlements with account %s, leaving out the one on %s until the next sync: %s", partner.Name, transactions[own].Date.Format("2006-01-02"), err)
+				leftOut[own] = true
+				continue
+			}
+			if !isLinked(cash[cashIndex], cashPosted, card[cardIndex], cardPosted) {
+				log.Printf("Posting settlement with account %s on %s as a regular transaction, its other side is in YNAB already", partner.Name, transactions[own].Date.Format("2006-01-02"))
+				continue
+			}
+			if isCard {
+				log.Printf("Leaving out settlement from account %s on %s, YNAB creates it with the transfer", partner.Name, transactions[own].Date.Format("2006-01-02"))
+				leftOut[own] = true
+				continue
+			}
+			if !setTransferPayee(&transactions[own], partner) {
+				leftOut[own] = true
+				continue
+			}
+			log.Printf("Posting settlement of account %s on %s as a transfer", partner.Name, transactions[own].Date.Format("2006-01-02"))
+		}
+	}
+	kept := make([]bank.Transaction, 0, len(transactions))
+	for i, transaction := range transactions {
+		if !leftOut[i] {
+			kept = append(kept, transaction)
+		}
+	}
+	return kept
+}
+
+// settlementLegs returns the transactions which can be a side of a card
+// settlement, with their indexes. Pending transactions are never one, they are
+// not booked yet.
+func settlementLegs(transactions []bank.Transaction, isLeg func(bank.Transaction) bool) ([]bank.Transaction, []int) {
+	var legs []bank.Transaction
+	var indexes []int
+	for i, transaction := range transactions {
+		if !transaction.Details.Pending && isLeg(transaction) {
+			legs = append(legs, transaction)
+			indexes = append(indexes, i)
+		}
+	}
+	return legs, indexes
+}
+
+// isSettlementDebit checks if a cash transaction is marked as a card
+// settlement by its counterparty, payment reference or creditor ID.
+func isSettlementDebit(transaction bank.Transaction) bool {
+	details := transaction.Details
+	return settlementReference.MatchString(details.CounterPartyName) ||
+		settlementReference.MatchString(details.PaymentReference) ||
+		settlementReference.MatchString(details.CreditorID)
+}
+
+// settlementPartners returns the configured accounts in the same budget which
+// card settlements move money to or from: the card accounts for a cash
+// account, and the cash accounts for a card account.
+func settlementPartners(account *syncAccount) []*syncAccount {
+	var partners []*syncAccount
+	for _, other := range accounts {
+		if other.Name == account.Name || other.YNABBudgetID != account.YNABBudgetID || other.connector == nil {
+			continue
+		}
+		if isCardAccount(other) != isCardAccount(account) {
+			partners = append(partners, other)
+		}
+	}
+	return partners
+}
+
+// isCardAccount checks if an account is a credit card, which DB identifies by
+// the last four digits of the card number.
+func isCardAccount(account *syncAccount) bool {
+	isCard, _ := dbapi.DbCreditConnector{}.IsValidAccountNumber(account.Number)
+	return isCard
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"go.bmvs.io/ynab/api"
+	"go.bmvs.io/ynab/api/account"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// settlementTestConnector returns the transactions of each account by number.
+type settlementTestConnector map[string][]bank.Transaction
+
+func (c settlementTestConnector) IsValidAccountNumber(string) (bool, error) {
+	return true, nil
+}
+
+func (c settlementTestConnector) GetTransactions(account config.Account, from time.Time, to time.Time) ([]bank.Transaction, error) {
+	return append([]bank.Transaction{}, c[account.Number]...), nil
+}
+
+func (c settlementTestConnector) Authorize() string {
+	return ""
+}
+
+func (c settlementTestConnector) AuthorizedHandler(http.ResponseWriter, *http.Request) {
+}
+
+func TestGetTransactionsSettlements(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	setDummyYnabData()
+	defer func() { ynabAccounts.byID = make(map[string]*account.Account) }()
+	date := func(value string) api.Date {
+		parsed, _ := api.DateFromString(value)
+		return parsed
+	}
+	payee, shop, category := "DB Kreditkarte", "Corner Shop", "groceries-id"
+	importIDs := []string{"debit-import-id", "other-debit-import-id", "credit-import-id", "other-credit-import-id", "purchase-import-id", "shop-debit-import-id", "refund-import-id", "small-debit-import-id", bank.PendingImportIDPrefix + "0123456789abcdef0123456789ab"}
+	settlementDetails := bank.Details{PaymentReference: "KREDITKARTENABRECHNUNG 1599"}
+	connector := settlementTestConnector{
+		goodIban: {
+			{PayloadTransaction: ynabTransaction{Date: date("2020-03-04"), Amount: -523120, PayeeName: &payee, CategoryID: &category, ImportID: &importIDs[0]}, Details: settlementDetails},
+			{PayloadTransaction: ynabTransaction{Date: date("2020-03-04"), Amount: -10000, PayeeName: &payee, ImportID: &importIDs[1]}, Details: settlementDetails},
+			{PayloadTransaction: ynabTransaction{Date: date("2020-03-02"), Amount: -45990, PayeeName: &shop, ImportID: &importIDs[5]}, Details: bank.Details{CounterPartyName: shop}},
+			{PayloadTransaction: ynabTransaction{Date: date("2020-03-04"), Amount: -7500, PayeeName: &payee, ImportID: &importIDs[7]}, Details: settlementDetails},
+		},
+		"1599": {
+			{PayloadTransaction: ynabTransaction{Date: date("2020-02-28"), Amount: 523120, PayeeName: &payee, ImportID: &importIDs[2]}},
+			{PayloadTransaction: ynabTransaction{Date: date("2020-02-20"), Amount: 10000, PayeeName: &payee, ImportID: &importIDs[3]}},
+			{PayloadTransaction: ynabTransaction{Date: date("2020-02-27"), Amount: -523120, PayeeName: &payee, ImportID: &importIDs[4]}},
+			{PayloadTransaction: ynabTransaction{Date: date("2020-03-03"), Amount: 45990, PayeeName: &shop, ImportID: &importIDs[6]}},
+			{PayloadTransaction: ynabTransaction{Date: date("2020-03-03"), Amount: 7500, PayeeName: &payee, ImportID: &importIDs[8]}, Details: bank.Details{Pending: true}},
+		},
+	}
+	accounts[0].connector = connector
+	card := &syncAccount{
+		Account:   config.Account{Name: "card", Number: "1599", YNABBudgetID: dummyYnabBudgetID, YNABAccountID: "card-id"},
+		connector: connector,
+	}
+	accounts = append(accounts, card)
+	mockYNAB := func(cashTransactions string, cardTransactions string) {
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/" + dummyYnabAccountID + "/transactions").
+			Reply(200).
+			BodyString(`{"data":{"transactions":[` + cashTransactions + `]}}`)
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/card-id/transactions").
+			Reply(200).
+			BodyString(`{"data":{"transactions":[` + cardTransactions + `]}}`)
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/card-id$").
+			Reply(200).
+			BodyString(`{"data":{"account":{"id":"card-id","name":"Card","on_budget":true,"transfer_payee_id":"card-payee-id"}}}`)
+	}
+	postedDebit := `{"id":"debit-id","date":"2020-03-04","amount":-523120,"cleared":"cleared","import_id":"debit-import-id"}`
+	postedCredit := `{"id":"credit-id","date":"2020-02-28","amount":523120,"cleared":"cleared","import_id":"credit-import-id"}`
+	t.Run("Cash debits become transfers to the card account", func(t *testing.T) {
+		defer gock.Off()
+		mockYNAB("", "")
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Posting settlement of account card on 2020-03-04 as a transfer")
+		transactions, err := getTransactions(accounts[0], time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testLogBuffer.TestLogValues(t)
+		settlement := transactions[0]
+		if settlement.PayeeID == nil || *settlement.PayeeID != "card-payee-id" || settlement.PayeeName != nil || settlement.CategoryID != nil {
+			t.Errorf("Settlement was not posted as a transfer: %+v", settlement.PayloadTransaction)
+		}
+		if transactions[1].PayeeID != nil {
+			t.Errorf("Debit without a card credit within the window became a transfer: %+v", transactions[1].PayloadTransaction)
+		}
+		if transactions[2].PayeeID != nil {
+			t.Errorf("Debit without a settlement reference became a transfer: %+v", transactions[2].PayloadTransaction)
+		}
+		if transactions[3].PayeeID != nil {
+			t.Errorf("Debit matching a pending card credit became a transfer: %+v", transactions[3].PayloadTransaction)
+		}
+	})
+	t.Run("Card credits are left out", func(t *testing.T) {
+		defer gock.Off()
+		mockYNAB("", "")
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Leaving out settlement from account default on 2020-02-28, YNAB creates it with the transfer")
+		transactions, err := getTransactions(card, time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testLogBuffer.TestLogValues(t)
+		if len(transactions) != 4 {
+			t.Fatalf("Got wrong number of transactions. Got %d want 4", len(transactions))
+		}
+		for _, transaction := range transactions {
+			if transaction.Amount == 523120 {
+				t.Errorf("Settlement credit was not left out: %+v", transaction.PayloadTransaction)
+			}
+		}
+	})
+	t.Run("Card credits are left out once the debit is a transfer", func(t *testing.T) {
+		defer gock.Off()
+		mockYNAB(`{"id":"debit-id","date":"2020-03-04","amount":-523120,"cleared":"cleared","transfer_account_id":"card-id","import_id":"debit-import-id"}`, "")
+		transactions, err := getTransactions(card, time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transactions) != 4 {
+			t.Errorf("Settlement credit was not left out after the transfer was posted: %+v", transactions)
+		}
+	})
+	for _, test := range []struct {
+		name       string
+		cashPosted string
+		cardPosted string
+	}{
+		{"Credit booked and posted first", "", postedCredit},
+		{"Debit booked and posted first", postedDebit, ""},
+	} {
+		t.Run(test.name+", both sides stay regular transactions", func(t *testing.T) {
+			defer gock.Off()
+			mockYNAB(test.cashPosted, test.cardPosted)
+			testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+			testLogBuffer.ExpectLog("Posting settlement with account card on 2020-03-04 as a regular transaction, its other side is in YNAB already")
+			transactions, err := getTransactions(accounts[0], time.Now(), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			testLogBuffer.TestLogValues(t)
+			if transactions[0].PayeeID != nil {
+				t.Errorf("Debit became a transfer while the other side is a regular transaction: %+v", transactions[0].PayloadTransaction)
+			}
+			mockYNAB(test.cashPosted, test.cardPosted)
+			transactions, err = getTransactions(card, time.Now(), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(transactions) != 5 {
+				t.Errorf("Credit was left out while the debit is a regular transaction: %+v", transactions)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errSyncInProgress is returned when a sync is requested while another one is running.
+var errSyncInProgress = errors.New("a sync is already in progress")
+
+// syncStatus tracks the running and last sync, whether it was started by an
+// HTTP request or the scheduler.
+type syncStatus struct {
+	mu           sync.Mutex
+	running      bool
+	lastRunStart time.Time
+	lastRunEnd   time.Time
+	lastRunError error
+	// drifts are the accounts whose balance differs between the bank and YNAB.
+	drifts []balanceDrift
+	// lastDrifts are the differences the last balance check of each account
+	// found, by account name, when there is no history to keep them.
+	lastDrifts map[string]int64
+}
+
+// syncState is shared by all syncs, so only one runs at a time.
+var syncState = &syncStatus{}
+
+// begin marks a sync as running. It returns false if one is already running.
+func (s *syncStatus) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return false
+	}
+	s.running = true
+	s.lastRunStart = time.Now()
+	s.drifts = nil
+	return true
+}
+
+// end marks the running sync as finished with the given result.
+func (s *syncStatus) end(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	s.lastRunEnd = time.Now()
+	s.lastRunError = err
+}
+
+// reportDrift adds a balance drift to the result of the running sync.
+func (s *syncStatus) reportDrift(drift balanceDrift) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drifts = append(s.drifts, drift)
+}
+
+// repeatedDrift records the balance difference of an account, and checks if
+// the previous check of the account found the same one.
+func (s *syncStatus) repeatedDrift(account string, drift int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastDrifts == nil {
+		s.lastDrifts = make(map[string]int64)
+	}
+	last, found := s.lastDrifts[account]
+	if drift == 0 {
+		delete(s.lastDrifts, account)
+	} else {
+		s.lastDrifts[account] = drift
+	}
+	return found && last == drift
+}
+
+// statusResponse is the JSON body of the /status endpoint.
+type statusResponse struct {
+	Running      bool       `json:"running"`
+	LastRunStart *time.Time `json:"last_run_start,omitempty"`
+	LastRunEnd   *time.Time `json:"last_run_end,omitempty"`
+	LastRunError string     `json:"last_run_error,omitempty"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+	// BalanceDrift lists the accounts whose balance differed after the last sync.
+	BalanceDrift []balanceDrift `json:"balance_drift,omitempty"`
+}
+
+// status returns the current sync status, with the next run of the scheduler if there is one.
+func (s *syncStatus) status(schedule *scheduler) statusResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response := statusResponse{
+		Running:      s.running,
+		LastRunStart: timeOrNil(s.lastRunStart),
+		LastRunEnd:   timeOrNil(s.lastRunEnd),
+		BalanceDrift: s.drifts,
+	}
+	if s.lastRunError != nil {
+		response.LastRunError = s.lastRunError.Error()
+	}
+	if schedule != nil {
+		response.NextRun = timeOrNil(schedule.NextRun())
+	}
+	return response
+}
+
+// StatusHandler handles HTTP requests to /status, reporting the last and next sync.
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(syncState.status(syncScheduler))
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
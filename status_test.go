@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+)
+
+func TestStatusHandler(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	defer func() { syncState = &syncStatus{}; syncScheduler = nil }()
+	syncState = &syncStatus{}
+	t.Run("Status before the first sync", func(t *testing.T) {
+		status := getStatus(t)
+		if status.Running || status.LastRunStart != nil || status.NextRun != nil {
+			t.Errorf("Got wrong status before the first sync: %+v", status)
+		}
+	})
+	t.Run("Status reports the last sync", func(t *testing.T) {
+		syncState.begin()
+		syncState.end(errors.New("failed syncing accounts: default"))
+		status := getStatus(t)
+		if status.LastRunStart == nil || status.LastRunEnd == nil {
+			t.Errorf("Status did not report the last sync: %+v", status)
+		}
+		if status.LastRunError != "failed syncing accounts: default" {
+			t.Errorf("Got wrong last sync error. Got %q want %q", status.LastRunError, "failed syncing accounts: default")
+		}
+	})
+	t.Run("Status reports the next scheduled sync", func(t *testing.T) {
+		syncScheduler, _ = newScheduler(config.Schedule{Interval: "1h"}, scheduledSync)
+		syncScheduler.Start()
+		defer syncScheduler.Stop()
+		status := getStatus(t)
+		if status.NextRun == nil {
+			t.Errorf("Status did not report the next sync: %+v", status)
+		}
+	})
+	t.Run("HTTP syncs are refused while a sync is running", func(t *testing.T) {
+		testConnectorAuthorizeResponse = ""
+		syncState.begin()
+		defer syncState.end(nil)
+		responseRecorder := runDummyRequest(t, "GET", "/sync", RootHandler)
+		AssertStatus(t, http.StatusConflict, responseRecorder.Code)
+		if !getStatus(t).Running {
+			t.Error("Status did not report the running sync")
+		}
+	})
+}
+
+func getStatus(t *testing.T) statusResponse {
+	responseRecorder := runDummyRequest(t, "GET", "/status", StatusHandler)
+	AssertStatus(t, http.StatusOK, responseRecorder.Code)
+	var status statusResponse
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
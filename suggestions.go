@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/categorizer"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+)
+
+var categorizerSettings config.Categorizer
+
+// suggestCategories sets the categories the categorizer is confident about on
+// transactions without a category. The model is trained on the account's
+// categorized transactions in YNAB, see postedSince; suggestions are made
+// locally. Without history, transactions are left uncategorized.
+func suggestCategories(account *syncAccount, transactions []bank.Transaction) {
+	if !categorizerSettings.Enabled {
+		return
+	}
+	var uncategorized []int
+	for i, transaction := range transactions {
+		if transaction.CategoryID == nil {
+			uncategorized = append(uncategorized, i)
+		}
+	}
+	if len(uncategorized) == 0 {
+		return
+	}
+	model, err := trainCategorizer(account, time.Now())
+	if err != nil {
+		log.Printf("Failed getting YNAB history to suggest categories, leaving transactions uncategorized: %s", err)
+		return
+	}
+	minConfidence := categorizerSettings.MinConfidence
+	if minConfidence == 0 {
+		minConfidence = config.DefaultMinConfidence
+	}
+	suggested := 0
+	for _, i := range uncategorized {
+		categoryID, confidence := model.Predict(categorizerText(transactions[i].PayeeName, transactions[i].Memo))
+		if categoryID == "" || confidence < minConfidence {
+			continue
+		}
+		transactions[i].CategoryID = &categoryID
+		suggested++
+	}
+	log.Printf("Suggested categories for %d of %d uncategorized transactions", suggested, len(uncategorized))
+}
+
+// trainCategorizer trains a model on the categorized transactions of the
+// account in YNAB. Transfers and split transactions are left out, as their
+// category says nothing about the payee.
+func trainCategorizer(account *syncAccount, now time.Time) (*categorizer.Model, error) {
+	history, err := postedSince(account, now.AddDate(0, 0, -categorizerHistoryDays()))
+	if err != nil {
+		return nil, err
+	}
+	var examples []categorizer.Example
+	for _, transaction := range history {
+		if transaction.Deleted || transaction.CategoryID == nil || transaction.TransferAccountID != nil {
+			continue
+		}
+		if len(transaction.SubTransactions) > 0 {
+			continue
+		}
+		examples = append(examples, categorizer.Example{
+			Text:     categorizerText(transaction.PayeeName, transaction.Memo),
+			Category: *transaction.CategoryID,
+		})
+	}
+	model := categorizer.Train(examples)
+	log.Printf("Learned categories from %d YNAB transactions of account %s", model.Size(), account.Name)
+	return model, nil
+}
+
+// categorizerText is the text the categorizer learns from: payee and memo.
+func categorizerText(payee *string, memo *string) string {
+	var parts []string
+	for _, value := range []*string{payee, memo} {
+		if value != nil {
+			parts = append(parts, *value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
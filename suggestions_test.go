@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"gopkg.in/h2non/gock.v1"
+)
+
+const historyResponse string = `{"data":{"transactions":[
+{"id":"1","date":"2020-04-01","amount":-23500,"payee_name":"REWE SAGT DANKE 4431","memo":"Einkauf","category_id":"groceries-id","deleted":false},
+{"id":"2","date":"2020-04-08","amount":-18050,"payee_name":"REWE Markt GmbH","memo":null,"category_id":"groceries-id","deleted":false},
+{"id":"3","date":"2020-04-09","amount":-45000,"payee_name":"Shell Tankstelle","memo":null,"category_id":"fuel-id","deleted":false},
+{"id":"4","date":"2020-04-10","amount":-5000,"payee_name":"REWE","memo":null,"category_id":"fuel-id","deleted":true},
+{"id":"5","date":"2020-04-11","amount":-90000,"payee_name":"Transfer : Savings","memo":null,"category_id":null,"transfer_account_id":"savings-id","deleted":false},
+{"id":"6","date":"2020-04-12","amount":-60000,"payee_name":"Costco","memo":null,"category_id":"split-id","category_name":"Split (Multiple Categories)...","deleted":false,"subtransactions":[{"id":"6a","transaction_id":"6","amount":-40000,"category_id":"groceries-id"},{"id":"6b","transaction_id":"6","amount":-20000,"category_id":"fuel-id"}]},
+{"id":"7","date":"2020-04-13","amount":-12000,"payee_name":"Splitwise","memo":"Dinner","category_id":"splitwise-id","category_name":"Splitwise","deleted":false}
+]}}`
+
+func TestSuggestCategories(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	setDummyYnabData()
+	defer func() { categorizerSettings = config.Categorizer{} }()
+	categorizerSettings = config.Categorizer{Enabled: true}
+	newTransactions := func() []bank.Transaction {
+		rewe, rossmann, rent := "REWE SAGT DANKE 1234//Hamburg/DE", "Rossmann", "rent-id"
+		transactions := make([]bank.Transaction, 3)
+		transactions[0].PayeeName = &rewe
+		transactions[1].PayeeName = &rossmann
+		transactions[2].PayeeName = &rewe
+		transactions[2].CategoryID = &rent
+		return transactions
+	}
+	t.Run("Confident suggestions are used", func(t *testing.T) {
+		defer gock.Off()
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+			MatchParam("since_date", `^\d{4}-\d{2}-\d{2}$`).
+			Reply(200).
+			BodyString(historyResponse)
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Learned categories from 4 YNAB transactions of account default")
+		testLogBuffer.ExpectLog("Suggested categories for 1 of 2 uncategorized transactions")
+		transactions := newTransactions()
+		suggestCategories(accounts[0], transactions)
+		testLogBuffer.TestLogValues(t)
+		if transactions[0].CategoryID == nil || *transactions[0].CategoryID != "groceries-id" {
+			t.Errorf("Got wrong suggested category: %v", transactions[0].CategoryID)
+		}
+		if transactions[1].CategoryID != nil {
+			t.Errorf("Unknown payee got category %s", *transactions[1].CategoryID)
+		}
+		if *transactions[2].CategoryID != "rent-id" {
+			t.Errorf("Existing category was replaced with %s", *transactions[2].CategoryID)
+		}
+	})
+	t.Run("Failing to get the history leaves transactions uncategorized", func(t *testing.T) {
+		defer gock.Off()
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/" + dummyYnabAccountID + "/transactions").
+			Reply(500)
+		transactions := newTransactions()
+		suggestCategories(accounts[0], transactions)
+		if transactions[0].CategoryID != nil {
+			t.Errorf("Got a category without history: %s", *transactions[0].CategoryID)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+)
+
+// formatTransactions sets the payee names and memos of an account's
+// transactions from its templates, and appends the original amount to the
+// memo of foreign currency transactions.
+func formatTransactions(account *syncAccount, transactions []bank.Transaction) error {
+	payeeTemplate, err := bank.ParseTemplate("payee_template", account.PayeeTemplate)
+	if err != nil {
+		return err
+	}
+	memoTemplate, err := bank.ParseTemplate("memo_template", account.MemoTemplate)
+	if err != nil {
+		return err
+	}
+	foreignCurrencyMemo := account.ForeignCurrencyMemo
+	if foreignCurrencyMemo == "" {
+		foreignCurrencyMemo = bank.DefaultForeignCurrencyMemo
+	}
+	foreignCurrencyTemplate, err := bank.ParseTemplate("foreign_currency_memo", foreignCurrencyMemo)
+	if err != nil {
+		return err
+	}
+	for i := range transactions {
+		if err := transactions[i].Format(payeeTemplate, memoTemplate); err != nil {
+			return err
+		}
+		if !transactions[i].Details.IsForeignCurrency() {
+			continue
+		}
+		if err := transactions[i].AppendMemo(foreignCurrencyTemplate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
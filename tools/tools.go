@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"log"
+	"math/big"
 	"strings"
 	"testing"
 )
@@ -16,9 +17,45 @@ func CreateImportID(source string) string {
 	return importID
 }
 
-// ConvertToMilliunits converts a decimal float to YNAB API's "milliunits".
-func ConvertToMilliunits(value float32) int64 {
-	return int64(value * 1000)
+// CreateYNABImportID creates an import ID in the format YNAB uses for file
+// imports, e.g. "YNAB:-19050:2019-11-04:1". Occurrences start at 1.
+func CreateYNABImportID(milliunits int64, date string, occurrence int) string {
+	return fmt.Sprintf("YNAB:%d:%s:%d", milliunits, date, occurrence)
+}
+
+// ConvertToMilliunits converts a decimal amount, e.g. "-19.05", exactly to YNAB
+// API's "milliunits". Fractions of a milliunit are rounded half away from zero.
+func ConvertToMilliunits(amount string) (int64, error) {
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	value.Mul(value, big.NewRat(1000, 1))
+	milliunits, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if remainder.Abs(remainder).Lsh(remainder, 1).Cmp(value.Denom()) >= 0 {
+		milliunits.Add(milliunits, big.NewInt(int64(value.Sign())))
+	}
+	if !milliunits.IsInt64() {
+		return 0, fmt.Errorf("amount %q is out of range", amount)
+	}
+	return milliunits.Int64(), nil
+}
+
+// NormalizeText collapses runs of whitespace to single spaces, trims the ends
+// and cuts the text to at most maxLength characters.
+func NormalizeText(text string, maxLength int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > maxLength {
+		text = strings.TrimSpace(string(runes[:maxLength]))
+	}
+	return text
+}
+
+// NormalizeIBAN removes spaces and converts to upper case, as IBANs are often
+// written in groups of four.
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Replace(iban, " ", "", -1))
 }
 
 // An in-memory log store for testing log outputs.
@@ -1,8 +1,10 @@
 package tools
 
 import (
+	"fmt"
 	"log"
 	"testing"
+	"testing/quick"
 )
 
 func TestCreateImportID(t *testing.T) {
@@ -19,13 +21,105 @@ func TestCreateImportID(t *testing.T) {
 	}
 }
 
+func TestCreateYNABImportID(t *testing.T) {
+	got := CreateYNABImportID(-19050, "2019-11-04", 2)
+	expect := "YNAB:-19050:2019-11-04:2"
+	if got != expect {
+		t.Errorf("YNAB import ID was incorrect. Expected %s got %s", expect, got)
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	for _, test := range []struct {
+		text      string
+		maxLength int
+		expect    string
+	}{
+		{"  POS MIT PIN.\tMein  Drogeriemarkt\n", 200, "POS MIT PIN. Mein Drogeriemarkt"},
+		{"Kölner Straße", 6, "Kölner"},
+		{"Kölner Straße", 7, "Kölner"},
+		{"", 50, ""},
+	} {
+		if got := NormalizeText(test.text, test.maxLength); got != test.expect {
+			t.Errorf("Normalized text was incorrect. Expected %q got %q", test.expect, got)
+		}
+	}
+}
+
 func TestConvertToMilliunits(t *testing.T) {
-	var input float32 = 1234.56
-	got := ConvertToMilliunits(input)
-	var expect float64 = 1234560
-	if float64(got) != expect {
-		t.Errorf("Milliunits conversion was incorrect. Expected %f got %d", expect, got)
+	t.Run("Decimal amounts are converted exactly", func(t *testing.T) {
+		for input, expect := range map[string]int64{
+			"1234.56": 1234560,
+			"-19.05":  -19050,
+			"0":       0,
+			"-0.01":   -10,
+			"1e3":     1000000,
+			"1.5E-2":  15,
+		} {
+			assertMilliunits(t, input, expect)
+		}
+	})
+	t.Run("Fractions of a milliunit are rounded half away from zero", func(t *testing.T) {
+		for input, expect := range map[string]int64{
+			"0.0005":  1,
+			"-0.0005": -1,
+			"0.0004":  0,
+			"1.2344":  1234,
+			"-1.2346": -1235,
+		} {
+			assertMilliunits(t, input, expect)
+		}
+	})
+	t.Run("Invalid amounts return an error", func(t *testing.T) {
+		for _, input := range []string{"", "abc", "1,50", "1e30"} {
+			if _, err := ConvertToMilliunits(input); err == nil {
+				t.Errorf("Invalid amount %q did not return an error", input)
+			}
+		}
+	})
+	t.Run("Every cent value is converted exactly", func(t *testing.T) {
+		for cents := int64(-100000); cents <= 100000; cents++ {
+			assertCentsConversion(t, cents)
+		}
+	})
+	t.Run("Random cent values are converted exactly", func(t *testing.T) {
+		property := func(cents int64) bool {
+			cents = cents % 1e15
+			got, err := ConvertToMilliunits(formatCents(cents))
+			return err == nil && got == cents*10
+		}
+		if err := quick.Check(property, &quick.Config{MaxCount: 10000}); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func assertMilliunits(t *testing.T, input string, expect int64) {
+	got, err := ConvertToMilliunits(input)
+	if err != nil {
+		t.Errorf("Unexpected error converting %q: %s", input, err)
+	}
+	if got != expect {
+		t.Errorf("Milliunits conversion of %q was incorrect. Expected %d got %d", input, expect, got)
+	}
+}
+
+func assertCentsConversion(t *testing.T, cents int64) {
+	input := formatCents(cents)
+	got, err := ConvertToMilliunits(input)
+	if err != nil || got != cents*10 {
+		t.Fatalf("Milliunits conversion of %q was incorrect. Expected %d got %d (%v)", input, cents*10, got, err)
+	}
+}
+
+// formatCents formats an amount in cents the way the DB API does, e.g. -19.05.
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
 	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
 }
 
 func TestTestLogBuffer(t *testing.T) {
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+)
+
+// getTransactions gets the transactions for an account booked between from and
+// to, and prepares them for YNAB: import IDs of earlier versions for
+// transactions imported with them, currency conversion, payee and memo
+// templates, payee rules, categories from rules or suggestions, approvals and
+// flags, import IDs in the account's format, and transfers and card
+// settlements between configured accounts.
+func getTransactions(account *syncAccount, from time.Time, to time.Time) ([]bank.Transaction, error) {
+	transactions, err := account.connector.GetTransactions(account.Account, from, to)
+	if err != nil {
+		return nil, err
+	}
+	keepLegacyImportIDs(account, from, transactions)
+	transactions = convertCurrencies(account, transactions)
+	if err := formatTransactions(account, transactions); err != nil {
+		return nil, err
+	}
+	if payeeRules != nil {
+		payeeRules.Apply(transactions)
+	}
+	knownPayees := knownPayeesFor(account, transactions)
+	categorize(account, transactions, knownPayees)
+	suggestCategories(account, transactions)
+	if reviewRules != nil {
+		reviewRules.Apply(transactions, knownPayees)
+	}
+	if account.ImportIDFormat == config.ImportIDFormatYNAB {
+		setYNABImportIDs(transactions)
+	}
+	transactions = markTransfers(account, from, to, transactions)
+	return linkSettlements(account, from, to, transactions), nil
+}
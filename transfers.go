@@ -0,0 +1,243 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"go.bmvs.io/ynab"
+	"go.bmvs.io/ynab/api/account"
+	"go.bmvs.io/ynab/api/transaction"
+)
+
+// ynabAccounts caches YNAB accounts by ID, for their transfer payee IDs, which
+// never change.
+var ynabAccounts = struct {
+	sync.Mutex
+	byID map[string]*account.Account
+}{byID: make(map[string]*account.Account)}
+
+// transferDays is how many days apart the two legs of a transfer between
+// configured accounts may be booked.
+const transferDays int = 3
+
+// markTransfers turns transactions with another configured account of the same
+// budget into YNAB transfers, by setting the transfer payee of that account.
+// YNAB creates the other leg of a transfer itself, so only outgoing transfers
+// are posted, and incoming ones are left out. That only happens while the two
+// legs are linked, see isLinked. Transfers between budget accounts have no
+// category.
+func markTransfers(account *syncAccount, from time.Time, to time.Time, transactions []bank.Transaction) []bank.Transaction {
+	leftOut := make(map[int]bool)
+	for _, counterpart := range accounts {
+		var legs []int
+		for i, transaction := range transactions {
+			if transferAccount(account, transaction.Details.CounterPartyIBAN) == counterpart {
+				legs = append(legs, i)
+			}
+		}
+		if len(legs) > 0 {
+			linkTransfers(account, counterpart, from, to, transactions, legs, leftOut)
+		}
+	}
+	kept := make([]bank.Transaction, 0, len(transactions))
+	for i, transaction := range transactions {
+		if !leftOut[i] {
+			kept = append(kept, transaction)
+		}
+	}
+	return kept
+}
+
+// linkTransfers marks the legs of transfers with a counterpart account: a
+// linked outgoing leg, or one the counterpart has not booked yet, becomes a
+// transfer, and a linked incoming leg is left out. The counterpart's
+// transactions are fetched from the bank to find the other legs. If they cannot
+// be checked, the legs are left out until the next sync.
+func linkTransfers(account *syncAccount, counterpart *syncAccount, from time.Time, to time.Time, transactions []bank.Transaction, legs []int, leftOut map[int]bool) {
+	own := make([]bank.Transaction, len(legs))
+	for k, i := range legs {
+		own[k] = transactions[i]
+	}
+	others, err := otherLegs(account, counterpart, from, to)
+	var posted, counterpartPosted map[string]*transaction.Transaction
+	if err == nil {
+		posted, err = postedByImportID(account, from.AddDate(0, 0, -transferDays))
+	}
+	if err == nil {
+		counterpartPosted, err = postedByImportID(counterpart, from.AddDate(0, 0, -transferDays))
+	}
+	if err != nil {
+		log.Printf("Failed checking transfers with account %s, leaving them out until the next sync: %s", counterpart.Name, err)
+		for _, i := range legs {
+			leftOut[i] = true
+		}
+		return
+	}
+	outgoing := matchLegs(own, others, transferDays)
+	incoming := make(map[int]bool)
+	for otherIndex, k := range matchLegs(others, own, transferDays) {
+		incoming[k] = isLinked(others[otherIndex], counterpartPosted, own[k], posted)
+	}
+	for k, i := range legs {
+		if own[k].Amount > 0 {
+			if incoming[k] {
+				log.Printf("Leaving out incoming transfer from account %s, YNAB creates it with the outgoing one", counterpart.Name)
+				leftOut[i] = true
+			}
+			continue
+		}
+		if otherIndex, paired := outgoing[k]; paired && !isLinked(own[k], posted, others[otherIndex], counterpartPosted) {
+			log.Printf("Posting transfer to account %s as a regular transaction, its other leg is in YNAB already", counterpart.Name)
+			continue
+		}
+		if !setTransferPayee(&transactions[i], counterpart) {
+			leftOut[i] = true
+		}
+	}
+}
+
+// otherLegs gets the counterpart's transactions with the account from the bank,
+// with import IDs in the counterpart's format.
+func otherLegs(account *syncAccount, counterpart *syncAccount, from time.Time, to time.Time) ([]bank.Transaction, error) {
+	transactions, err := counterpart.connector.GetTransactions(counterpart.Account, from.AddDate(0, 0, -transferDays), to.AddDate(0, 0, transferDays))
+	if err != nil {
+		return nil, err
+	}
+	if counterpart.ImportIDFormat == config.ImportIDFormatYNAB {
+		setYNABImportIDs(transactions)
+	}
+	var legs []bank.Transaction
+	for _, transaction := range transactions {
+		if transferAccount(counterpart, transaction.Details.CounterPartyIBAN) == account {
+			legs = append(legs, transaction)
+		}
+	}
+	return legs, nil
+}
+
+// setTransferPayee makes a transaction a transfer to another account. If the
+// YNAB account cannot be fetched, it returns false and the transaction is left
+// out until the next sync, so it is never posted as a regular transaction while
+// its other leg is left out.
+func setTransferPayee(transaction *bank.Transaction, counterpart *syncAccount) bool {
+	ynabAccount, err := getYNABAccount(counterpart.YNABBudgetID, counterpart.YNABAccountID)
+	if err != nil {
+		log.Printf("Failed getting YNAB account %s, leaving out transfer to account %s until the next sync: %s", counterpart.YNABAccountID, counterpart.Name, err)
+		return false
+	}
+	transaction.PayeeID = &ynabAccount.TransferPayeeID
+	transaction.PayeeName = nil
+	if ynabAccount.OnBudget {
+		transaction.CategoryID = nil
+	}
+	return true
+}
+
+// isLinked checks if the outgoing and incoming legs of a transfer are posted as
+// one YNAB transfer. They are while the incoming leg is not in YNAB, and the
+// outgoing leg is not in YNAB either or is in it as a transfer. Otherwise one
+// leg is in YNAB as a regular transaction, e.g. because it was imported before
+// transfers were recognized, and the other is posted as one too, so no money
+// goes missing or is counted twice. Both accounts see the same legs in YNAB, so
+// they decide the same way whichever of them syncs first.
+func isLinked(outgoing bank.Transaction, outgoingPosted map[string]*transaction.Transaction, incoming bank.Transaction, incomingPosted map[string]*transaction.Transaction) bool {
+	if findPosted(incomingPosted, incoming) != nil {
+		return false
+	}
+	posted := findPosted(outgoingPosted, outgoing)
+	return posted == nil || posted.TransferAccountID != nil
+}
+
+// matchLegs pairs incoming transactions with outgoing ones of the same amount,
+// booked at most days apart. Each incoming transaction takes the closest
+// unpaired outgoing one, so both accounts pair their transactions the same way.
+// It returns the index of the incoming transaction for each paired outgoing
+// one.
+func matchLegs(outgoing []bank.Transaction, incoming []bank.Transaction, days int) map[int]int {
+	matches := make(map[int]int)
+	window := time.Duration(days) * 24 * time.Hour
+	for incomingIndex, credit := range incoming {
+		if credit.Amount <= 0 {
+			continue
+		}
+		best := -1
+		var bestDistance time.Duration
+		for outgoingIndex, debit := range outgoing {
+			if _, paired := matches[outgoingIndex]; paired || debit.Amount != -credit.Amount {
+				continue
+			}
+			distance := debit.Date.Sub(credit.Date.Time)
+			if distance < 0 {
+				distance = -distance
+			}
+			if distance <= window && (best == -1 || distance < bestDistance) {
+				best, bestDistance = outgoingIndex, distance
+			}
+		}
+		if best != -1 {
+			matches[best] = incomingIndex
+		}
+	}
+	return matches
+}
+
+// postedByImportID gets an account's transactions in YNAB since a date, by
+// import ID.
+func postedByImportID(account *syncAccount, since time.Time) (map[string]*transaction.Transaction, error) {
+	existing, err := postedSince(account, since)
+	if err != nil {
+		return nil, err
+	}
+	posted := make(map[string]*transaction.Transaction)
+	for _, existingTransaction := range existing {
+		if !existingTransaction.Deleted && existingTransaction.ImportID != nil {
+			posted[*existingTransaction.ImportID] = existingTransaction
+		}
+	}
+	return posted, nil
+}
+
+// findPosted returns a transaction in YNAB, by its import ID or the import ID
+// earlier versions gave it, or nil.
+func findPosted(posted map[string]*transaction.Transaction, t bank.Transaction) *transaction.Transaction {
+	if t.ImportID != nil && posted[*t.ImportID] != nil {
+		return posted[*t.ImportID]
+	}
+	if t.LegacyImportID != "" {
+		return posted[t.LegacyImportID]
+	}
+	return nil
+}
+
+// transferAccount returns the configured account in the same budget with the
+// given IBAN, or nil.
+func transferAccount(account *syncAccount, iban string) *syncAccount {
+	if iban == "" {
+		return nil
+	}
+	for _, other := range accounts {
+		if other.Name != account.Name && other.YNABBudgetID == account.YNABBudgetID && tools.NormalizeIBAN(other.Number) == tools.NormalizeIBAN(iban) {
+			return other
+		}
+	}
+	return nil
+}
+
+// getYNABAccount gets a YNAB account, from the cache if we had it before.
+func getYNABAccount(budgetID string, accountID string) (*account.Account, error) {
+	ynabAccounts.Lock()
+	defer ynabAccounts.Unlock()
+	if cached, ok := ynabAccounts.byID[accountID]; ok {
+		return cached, nil
+	}
+	fetched, err := ynab.NewClient(ynabSecret).Account().GetAccount(budgetID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	ynabAccounts.byID[accountID] = fetched
+	return fetched, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"go.bmvs.io/ynab/api"
+	"go.bmvs.io/ynab/api/account"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestGetTransactionsTransfers(t *testing.T) {
+	setDummyConnector(true)
+	defer resetTestConnectorResponses()
+	setDummyYnabData()
+	defer func() { ynabAccounts.byID = make(map[string]*account.Account) }()
+	date, _ := api.DateFromString("2020-03-04")
+	savingsIban := "DE89370400440532013000"
+	payee, category, fromSavingsID := "Me", "groceries-id", "from-savings-import-id"
+	connector := settlementTestConnector{
+		goodIban: {
+			{PayloadTransaction: ynabTransaction{Date: date, Amount: -100000, PayeeName: &payee, CategoryID: &category}, Details: bank.Details{CounterPartyIBAN: "DE89 3704 0044 0532 0130 00"}},
+			{PayloadTransaction: ynabTransaction{Date: date, Amount: 50000, PayeeName: &payee}, Details: bank.Details{CounterPartyIBAN: savingsIban}},
+			{PayloadTransaction: ynabTransaction{Date: date, Amount: -2000, PayeeName: &payee}, Details: bank.Details{CounterPartyIBAN: "DE02120300000000202051"}},
+		},
+		savingsIban: {
+			{PayloadTransaction: ynabTransaction{Date: date, Amount: -50000, PayeeName: &payee, ImportID: &fromSavingsID}, Details: bank.Details{CounterPartyIBAN: goodIban}},
+		},
+	}
+	accounts[0].connector = connector
+	accounts = append(accounts, &syncAccount{
+		Account:   config.Account{Name: "savings", Number: savingsIban, YNABBudgetID: dummyYnabBudgetID, YNABAccountID: "savings-id"},
+		connector: connector,
+	})
+	mockYNAB := func(savingsTransactions string) {
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/" + dummyYnabAccountID + "/transactions").
+			Reply(200).
+			BodyString(`{"data":{"transactions":[]}}`)
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/savings-id/transactions").
+			Reply(200).
+			BodyString(`{"data":{"transactions":[` + savingsTransactions + `]}}`)
+	}
+	mockSavingsAccount := func() {
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/savings-id$").
+			Reply(200).
+			BodyString(`{"data":{"account":{"id":"savings-id","name":"Savings","on_budget":true,"transfer_payee_id":"savings-payee-id"}}}`)
+	}
+	t.Run("Outgoing transfers are posted as transfers and incoming ones left out", func(t *testing.T) {
+		defer gock.Off()
+		mockYNAB("")
+		mockSavingsAccount()
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Leaving out incoming transfer from account savings, YNAB creates it with the outgoing one")
+		transactions, err := getTransactions(accounts[0], time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testLogBuffer.TestLogValues(t)
+		if len(transactions) != 2 {
+			t.Fatalf("Got wrong number of transactions. Got %d want 2", len(transactions))
+		}
+		transfer := transactions[0]
+		if transfer.PayeeID == nil || *transfer.PayeeID != "savings-payee-id" || transfer.PayeeName != nil || transfer.CategoryID != nil {
+			t.Errorf("Outgoing transfer was not posted as a transfer: %+v", transfer.PayloadTransaction)
+		}
+		if transactions[1].PayeeID != nil {
+			t.Errorf("Transaction with another IBAN became a transfer: %+v", transactions[1].PayloadTransaction)
+		}
+	})
+	t.Run("Incoming transfers are kept when the outgoing leg is a regular transaction", func(t *testing.T) {
+		defer gock.Off()
+		mockYNAB(`{"id":"from-savings-id","date":"2020-03-04","amount":-50000,"cleared":"cleared","import_id":"from-savings-import-id"}`)
+		mockSavingsAccount()
+		transactions, err := getTransactions(accounts[0], time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transactions) != 3 || transactions[1].Amount != 50000 {
+			t.Errorf("Incoming transfer was left out while its outgoing leg is not a transfer: %+v", transactions)
+		}
+	})
+	t.Run("Incoming transfers are left out when the outgoing leg is a transfer", func(t *testing.T) {
+		defer gock.Off()
+		mockYNAB(`{"id":"from-savings-id","date":"2020-03-04","amount":-50000,"cleared":"cleared","transfer_account_id":"` + dummyYnabAccountID + `","import_id":"from-savings-import-id"}`)
+		mockSavingsAccount()
+		transactions, err := getTransactions(accounts[0], time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transactions) != 2 {
+			t.Errorf("Incoming leg of a transfer was not left out: %+v", transactions)
+		}
+	})
+	t.Run("Transfers are left out when the YNAB account cannot be fetched", func(t *testing.T) {
+		defer gock.Off()
+		ynabAccounts.byID = make(map[string]*account.Account)
+		mockYNAB("")
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/" + dummyYnabBudgetID + "/accounts/savings-id$").
+			Reply(500)
+		transactions, err := getTransactions(accounts[0], time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transactions) != 1 || transactions[0].Amount != -2000 {
+			t.Errorf("Transfer was posted without its YNAB account: %+v", transactions)
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/config"
+	"go.bmvs.io/ynab/api/transaction"
+)
+
+// updateChangedTransactions updates the transactions YNAB reported as
+// duplicates when the bank changed their cleared status, amount or date since
+// they were imported. It returns how many it updated. Only transactions which
+// keep their import ID can be updated, see updateCorrected for the others.
+func updateChangedTransactions(account *syncAccount, from time.Time, transactions []bank.Transaction, duplicateImportIDs []string) int {
+	duplicates := make(map[string]bool)
+	for _, importID := range duplicateImportIDs {
+		duplicates[importID] = true
+	}
+	existing, err := postedSince(account, from)
+	if err != nil {
+		log.Printf("Failed getting YNAB transactions, not updating changed transactions: %s", err)
+		return 0
+	}
+	byImportID := make(map[string]*transaction.Transaction)
+	for _, posted := range existing {
+		if !posted.Deleted && posted.ImportID != nil && duplicates[*posted.ImportID] {
+			byImportID[*posted.ImportID] = posted
+		}
+	}
+	updated := 0
+	for _, changed := range transactions {
+		if changed.ImportID == nil {
+			continue
+		}
+		posted, ok := byImportID[*changed.ImportID]
+		if !ok || !hasBankChanges(posted, changed.PayloadTransaction) {
+			continue
+		}
+		if err := updatePosted(account, posted, keepYNABEdits(posted, changed.PayloadTransaction)); err != nil {
+			log.Printf("Failed updating YNAB transaction %s: %s", posted.ID, err)
+			continue
+		}
+		updated++
+	}
+	return updated
+}
+
+// hasBankChanges checks if the bank changed the cleared status, amount or date
+// of a transaction in YNAB. Reconciled transactions count as cleared.
+func hasBankChanges(posted *transaction.Transaction, changed ynabTransaction) bool {
+	cleared := posted.Cleared
+	if cleared == transaction.ClearingStatusReconciled {
+		cleared = transaction.ClearingStatusCleared
+	}
+	return cleared != changed.Cleared || posted.Amount != changed.Amount || !posted.Date.Equal(changed.Date.Time)
+}
+
+// keepYNABEdits returns the bank's version of a transaction with the fields
+// which may have been edited in YNAB taken from the YNAB transaction: approval,
+// payee, category, memo and flag. A reconciled transaction stays reconciled.
+func keepYNABEdits(posted *transaction.Transaction, changed ynabTransaction) ynabTransaction {
+	if posted.Cleared == transaction.ClearingStatusReconciled && changed.Cleared == transaction.ClearingStatusCleared {
+		changed.Cleared = posted.Cleared
+	}
+	changed.Approved = posted.Approved
+	changed.PayeeID = posted.PayeeID
+	changed.PayeeName = posted.PayeeName
+	changed.CategoryID = posted.CategoryID
+	changed.Memo = posted.Memo
+	changed.FlagColor = posted.FlagColor
+	return changed
+}
+
+// correctionDays is how many days the bank may move the date of a transaction
+// it corrects without changing the amount.
+const correctionDays int = 3
+
+// importIDsChangeWithBankData checks if the import IDs of an account are made
+// from the amount and date of its transactions, so a transaction whose amount
+// or date the bank corrects gets a new import ID. Card transactions have no IDs
+// of their own, and YNAB's import ID format has none either.
+func importIDsChangeWithBankData(account *syncAccount) bool {
+	return account.ImportIDFormat == config.ImportIDFormatYNAB || isCardAccount(account)
+}
+
+// updateCorrected updates the transactions the bank corrected, on accounts
+// whose import IDs change with the amount or date. A transaction in YNAB which
+// the bank no longer returns between from and to is paired with a new
+// transaction, see findCorrection, and updated with its date, amount, import
+// ID and cleared status like updateChangedTransactions does. The new
+// transaction is left out, so it is not in YNAB twice. fetched are all the
+// transactions the bank returned, transactions the ones left to post. Pending
+// transactions are left to reconcilePending. A preview, for a dry run, does not
+// update YNAB but leaves out the same transactions as a sync.
+func updateCorrected(account *syncAccount, from time.Time, to time.Time, fetched []bank.Transaction, transactions []bank.Transaction, preview bool) []bank.Transaction {
+	if !importIDsChangeWithBankData(account) {
+		return transactions
+	}
+	posted, err := postedByImportID(account, from)
+	if err != nil {
+		log.Printf("Failed getting YNAB transactions, not checking for transactions the bank corrected: %s", err)
+		return transactions
+	}
+	current := make(map[string]bool)
+	for _, transaction := range fetched {
+		current[importIDValue(transaction)] = true
+		current[transaction.LegacyImportID] = true
+	}
+	var vanished []*transaction.Transaction
+	for importID, postedTransaction := range posted {
+		if !current[importID] && !strings.HasPrefix(importID, bank.PendingImportIDPrefix) && !postedTransaction.Date.After(to) {
+			vanished = append(vanished, postedTransaction)
+		}
+	}
+	sort.Slice(vanished, func(a, b int) bool {
+		if !vanished[a].Date.Equal(vanished[b].Date.Time) {
+			return vanished[a].Date.Before(vanished[b].Date.Time)
+		}
+		return *vanished[a].ImportID < *vanished[b].ImportID
+	})
+	replaced := make(map[int]bool)
+	for _, old := range vanished {
+		corrected := findCorrection(old, transactions, posted, replaced)
+		if corrected < 0 {
+			log.Printf("Transaction of %s on %s is in YNAB but no longer at the bank, delete it in YNAB if it was cancelled", formatMilliunits(old.Amount), old.Date.Format("2006-01-02"))
+			continue
+		}
+		update := keepYNABEdits(old, transactions[corrected].PayloadTransaction)
+		oldAmount, oldDate := formatMilliunits(old.Amount), old.Date.Format("2006-01-02")
+		if preview {
+			log.Printf("Transaction of %s on %s was corrected by the bank to %s on %s, not updating it in a dry run", oldAmount, oldDate, formatMilliunits(update.Amount), update.Date.Format("2006-01-02"))
+			replaced[corrected] = true
+			continue
+		}
+		if err := updatePosted(account, old, update); err != nil {
+			log.Printf("Failed updating corrected transaction %s, posting the new one: %s", old.ID, err)
+			continue
+		}
+		log.Printf("Updated transaction of %s on %s, the bank corrected it to %s on %s", oldAmount, oldDate, formatMilliunits(update.Amount), update.Date.Format("2006-01-02"))
+		replaced[corrected] = true
+	}
+	kept := make([]bank.Transaction, 0, len(transactions))
+	for i, transaction := range transactions {
+		if !replaced[i] {
+			kept = append(kept, transaction)
+		}
+	}
+	return kept
+}
+
+// findCorrection returns the index of the new transaction which replaces one
+// the bank corrected, or -1: of those booked on the same date, the one closest
+// in amount, or else one of the same amount booked at most correctionDays
+// apart. Transactions in YNAB, pending ones and those replacing another
+// transaction are skipped, as are transactions in the other direction.
+func findCorrection(old *transaction.Transaction, transactions []bank.Transaction, posted map[string]*transaction.Transaction, replaced map[int]bool) int {
+	window := time.Duration(correctionDays) * 24 * time.Hour
+	sameDate, sameAmount := -1, -1
+	var bestDifference int64
+	var sameAmountDistance time.Duration
+	for i, candidate := range transactions {
+		if candidate.Details.Pending || replaced[i] || findPosted(posted, candidate) != nil || (candidate.Amount < 0) != (old.Amount < 0) {
+			continue
+		}
+		if candidate.Date.Equal(old.Date.Time) {
+			difference := candidate.Amount - old.Amount
+			if difference < 0 {
+				difference = -difference
+			}
+			if sameDate < 0 || difference < bestDifference {
+				sameDate, bestDifference = i, difference
+			}
+			continue
+		}
+		distance := candidate.Date.Sub(old.Date.Time)
+		if distance < 0 {
+			distance = -distance
+		}
+		if candidate.Amount == old.Amount && distance <= window && (sameAmount < 0 || distance < sameAmountDistance) {
+			sameAmount, sameAmountDistance = i, distance
+		}
+	}
+	if sameDate >= 0 {
+		return sameDate
+	}
+	return sameAmount
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ohthehugemanatee/db-to-ynab-golang/bank"
+	"github.com/ohthehugemanatee/db-to-ynab-golang/tools"
+	"go.bmvs.io/ynab/api"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestUpdateChangedTransactions(t *testing.T) {
+	setDummyConnector(true)
+	setDummyYnabData()
+	defer gock.Off()
+	date, _ := api.DateFromString("2020-03-04")
+	payee, changedID, unchangedID, reconciledID := "Rewe", "changed-import-id", "unchanged-import-id", "reconciled-import-id"
+	transactions := []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -25990, PayeeName: &payee, Cleared: "cleared", ImportID: &changedID}},
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -1000, PayeeName: &payee, Cleared: "cleared", ImportID: &unchangedID}},
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -2000, PayeeName: &payee, Cleared: "cleared", ImportID: &reconciledID}},
+	}
+	gock.New("https://api.youneedabudget.com/").
+		Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+		MatchParam("since_date", "2020-03-01").
+		Reply(200).
+		BodyString(`{"data":{"transactions":[
+			{"id":"changed-id","date":"2020-03-03","amount":-25000,"cleared":"uncleared","approved":true,"payee_name":"Supermarket","category_id":"groceries-id","memo":"Party","import_id":"changed-import-id"},
+			{"id":"unchanged-id","date":"2020-03-04","amount":-1000,"cleared":"cleared","import_id":"unchanged-import-id"},
+			{"id":"reconciled-id","date":"2020-03-04","amount":-2000,"cleared":"reconciled","import_id":"reconciled-import-id"}
+		]}}`)
+	gock.New("https://api.youneedabudget.com/").
+		Put("/v1/budgets/" + dummyYnabBudgetID + "/transactions/changed-id").
+		MatchType("json").
+		JSON(`{"transaction":{"account_id":"","date":"2020-03-04","amount":-25990,"cleared":"cleared","approved":true,"payee_id":null,"payee_name":"Supermarket","category_id":"groceries-id","memo":"Party","flag_color":null,"import_id":"changed-import-id"}}`).
+		Reply(200).
+		BodyString(`{"data":{"transaction":{"id":"changed-id"}}}`)
+	updated := updateChangedTransactions(accounts[0], time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), transactions, []string{changedID, unchangedID, reconciledID})
+	if updated != 1 {
+		t.Errorf("Got wrong number of updated transactions. Got %d want 1", updated)
+	}
+	if !gock.IsDone() {
+		t.Error("Changed transaction was not updated in YNAB")
+	}
+}
+
+func TestUpdateCorrected(t *testing.T) {
+	setDummyConnector(true)
+	setDummyYnabData()
+	defer gock.Off()
+	defer func() { accounts[0].Number = goodIban }()
+	from, to := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 3, 10, 0, 0, 0, 0, time.UTC)
+	date, _ := api.DateFromString("2020-03-04")
+	laterDate, _ := api.DateFromString("2020-03-08")
+	payee, shop := "COFFEE SHOP", "Book Shop"
+	correctedID, movedID, newID := "corrected-import-id", "moved-import-id", "new-import-id"
+	transactions := []bank.Transaction{
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -3600, PayeeName: &payee, Cleared: "cleared", ImportID: &correctedID}},
+		{PayloadTransaction: ynabTransaction{Date: date, Amount: -1500, PayeeName: &shop, Cleared: "cleared", ImportID: &movedID}},
+		{PayloadTransaction: ynabTransaction{Date: laterDate, Amount: -800, PayeeName: &shop, Cleared: "cleared", ImportID: &newID}},
+	}
+	mockYNABTransactions := func() {
+		gock.New("https://api.youneedabudget.com/").
+			Get("/v1/budgets/"+dummyYnabBudgetID+"/accounts/"+dummyYnabAccountID+"/transactions").
+			MatchParam("since_date", "2020-03-01").
+			Reply(200).
+			BodyString(`{"data":{"transactions":[
+				{"id":"original-id","date":"2020-03-04","amount":-3500,"cleared":"cleared","approved":true,"payee_name":"Coffee Shop","category_id":"eating-out-id","import_id":"original-import-id"},
+				{"id":"early-id","date":"2020-03-02","amount":-1500,"cleared":"cleared","payee_name":"Book Shop","import_id":"early-import-id"},
+				{"id":"cancelled-id","date":"2020-03-06","amount":-700,"cleared":"cleared","import_id":"cancelled-import-id"},
+				{"id":"pending-id","date":"2020-03-05","amount":-900,"cleared":"uncleared","import_id":"PENDING:0123456789abcdef0123456789ab"},
+				{"id":"manual-id","date":"2020-03-05","amount":-1200,"cleared":"uncleared"},
+				{"id":"later-id","date":"2020-03-20","amount":-500,"cleared":"cleared","import_id":"later-import-id"}
+			]}}`)
+	}
+	assertKeptNew := func(t *testing.T, kept []bank.Transaction) {
+		if len(kept) != 1 || *kept[0].ImportID != newID {
+			t.Errorf("Corrected transactions were not left out. Got %+v", kept)
+		}
+	}
+	t.Run("Card transactions the bank corrected are updated", func(t *testing.T) {
+		accounts[0].Number = "1599"
+		mockYNABTransactions()
+		gock.New("https://api.youneedabudget.com/").
+			Put("/v1/budgets/" + dummyYnabBudgetID + "/transactions/early-id").
+			MatchType("json").
+			JSON(`{"transaction":{"account_id":"","date":"2020-03-04","amount":-1500,"cleared":"cleared","approved":false,"payee_id":null,"payee_name":"Book Shop","category_id":null,"memo":null,"flag_color":null,"import_id":"moved-import-id"}}`).
+			Reply(200).
+			BodyString(`{"data":{"transaction":{"id":"early-id"}}}`)
+		gock.New("https://api.youneedabudget.com/").
+			Put("/v1/budgets/" + dummyYnabBudgetID + "/transactions/original-id").
+			MatchType("json").
+			JSON(`{"transaction":{"account_id":"","date":"2020-03-04","amount":-3600,"cleared":"cleared","approved":true,"payee_id":null,"payee_name":"Coffee Shop","category_id":"eating-out-id","memo":null,"flag_color":null,"import_id":"corrected-import-id"}}`).
+			Reply(200).
+			BodyString(`{"data":{"transaction":{"id":"original-id"}}}`)
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Updated transaction of -1.50 on 2020-03-02, the bank corrected it to -1.50 on 2020-03-04")
+		testLogBuffer.ExpectLog("Updated transaction of -3.50 on 2020-03-04, the bank corrected it to -3.60 on 2020-03-04")
+		testLogBuffer.ExpectLog("Transaction of -0.70 on 2020-03-06 is in YNAB but no longer at the bank, delete it in YNAB if it was cancelled")
+		assertKeptNew(t, updateCorrected(accounts[0], from, to, transactions, transactions, false))
+		testLogBuffer.TestLogValues(t)
+		if !gock.IsDone() {
+			t.Error("Corrected transactions were not updated in YNAB")
+		}
+	})
+	t.Run("A dry run does not update them", func(t *testing.T) {
+		accounts[0].Number = "1599"
+		mockYNABTransactions()
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		testLogBuffer.ExpectLog("Transaction of -1.50 on 2020-03-02 was corrected by the bank to -1.50 on 2020-03-04, not updating it in a dry run")
+		testLogBuffer.ExpectLog("Transaction of -3.50 on 2020-03-04 was corrected by the bank to -3.60 on 2020-03-04, not updating it in a dry run")
+		testLogBuffer.ExpectLog("Transaction of -0.70 on 2020-03-06 is in YNAB but no longer at the bank, delete it in YNAB if it was cancelled")
+		assertKeptNew(t, updateCorrected(accounts[0], from, to, transactions, transactions, true))
+		testLogBuffer.TestLogValues(t)
+		if gock.HasUnmatchedRequest() {
+			t.Error("Updated YNAB in a dry run")
+		}
+	})
+	t.Run("Cash accounts with their own import IDs are not checked", func(t *testing.T) {
+		accounts[0].Number = goodIban
+		testLogBuffer := tools.CreateAndActivateEmptyTestLogBuffer()
+		if kept := updateCorrected(accounts[0], from, to, transactions, transactions, false); len(kept) != len(transactions) {
+			t.Errorf("Left out transactions of a cash account. Got %+v", kept)
+		}
+		testLogBuffer.TestLogValues(t)
+		if gock.HasUnmatchedRequest() {
+			t.Error("Checked YNAB for corrected transactions of a cash account")
+		}
+	})
+}